@@ -0,0 +1,704 @@
+package otelpgx
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ConnectAuthMethodKey represents the authentication method requested by
+	// the server while connecting, e.g. scram or md5.
+	ConnectAuthMethodKey = attribute.Key("pgx.connect.auth_method")
+	// ServerVersionKey represents the server_version reported by the server.
+	ServerVersionKey = attribute.Key("pgx.server.version")
+	// ServerApplicationNameKey represents the application_name reported by the server.
+	ServerApplicationNameKey = attribute.Key("pgx.server.application_name")
+	// ServerTimeZoneKey represents the TimeZone reported by the server.
+	ServerTimeZoneKey = attribute.Key("pgx.server.time_zone")
+	// ServerEncodingKey represents the server_encoding reported by the server.
+	ServerEncodingKey = attribute.Key("pgx.server.encoding")
+	// BackendPIDKey represents the process ID of the server backend serving
+	// the connection.
+	BackendPIDKey = attribute.Key("pgx.backend_pid")
+	// ConnectFallbackIndexKey represents which configured host was connected
+	// to: 0 for the primary host, i+1 for the i-th entry of the fallbacks.
+	ConnectFallbackIndexKey = attribute.Key("pgx.connect.fallback_index")
+	// ConnectPhaseKey represents a phase of establishing a connection, one of
+	// "lookup", "dial", "tls", "auth" or "startup".
+	ConnectPhaseKey = attribute.Key("pgx.connect.phase")
+	// DBClientConnectionPhaseDurationKey represents the duration of the
+	// phases of establishing a connection
+	DBClientConnectionPhaseDurationKey = attribute.Key("db.client.connection.phase.duration")
+)
+
+const (
+	connectPhaseLookup  = "lookup"
+	connectPhaseDial    = "dial"
+	connectPhaseTLS     = "tls"
+	connectPhaseAuth    = "auth"
+	connectPhaseStartup = "startup"
+)
+
+// serverIdentityDataKey is the key of the cached server identity attributes
+// in the custom data of a connection.
+const serverIdentityDataKey = "otelpgx.server_identity"
+
+// connectionAttributesDataKey is the key of the cached connection attributes
+// in the custom data of a connection.
+const connectionAttributesDataKey = "otelpgx.connection_attributes"
+
+// snifferDataKey is the key of the sniffingReader in the custom data of a
+// connection established with the tracer.
+const snifferDataKey = "otelpgx.sniffer"
+
+// serverParameters are the server parameters included in the server identity
+// attributes, with their attribute keys.
+var serverParameters = []struct {
+	name string
+	key  attribute.Key
+}{
+	{"server_version", ServerVersionKey},
+	{"application_name", ServerApplicationNameKey},
+	{"TimeZone", ServerTimeZoneKey},
+	{"server_encoding", ServerEncodingKey},
+}
+
+// Authentication request types sent by the server in the first
+// AuthenticationRequest message,
+// see https://www.postgresql.org/docs/current/protocol-message-formats.html.
+var authMethods = map[uint32]string{
+	0:  "trust",
+	2:  "kerberos",
+	3:  "password",
+	5:  "md5",
+	7:  "gss",
+	9:  "sspi",
+	10: "scram",
+}
+
+// connectState collects details about a single connect operation while it is
+// in progress. It is filled by the hooks installed into the connection config
+// by instrumentConnect and read in TraceConnectEnd.
+type connectState struct {
+	mu sync.Mutex
+
+	// poolName is the db.client.connection.pool.name of the connection, see
+	// Tracer.connectPoolName.
+	poolName string
+
+	// hostsByAddr maps resolved addresses back to the configured host names.
+	hostsByAddr map[string]string
+
+	// hosts are the primary host followed by the fallbacks of the
+	// configuration.
+	hosts []pgconn.FallbackConfig
+
+	serverAddress string
+	serverPort    int
+	fallbackIndex int
+	authMethod    string
+
+	// sniffer inspects the messages received on the last connection attempt.
+	sniffer *sniffingReader
+
+	// done is set once the connect operation has ended. pgconn reuses the
+	// hooks of the config afterwards, e.g. to dial for a cancel request,
+	// which must not be recorded as part of the connect operation.
+	done bool
+
+	// dialedAt, netConnectedAt and authenticatedAt are the end times of the
+	// dial, TLS and authentication phases of the last connection attempt.
+	dialedAt        time.Time
+	netConnectedAt  time.Time
+	authenticatedAt time.Time
+}
+
+// instrumentConnect installs hooks into config to observe which server is
+// dialed and which authentication method it requests, and to record the
+// phases of the connect operation as child spans, events and metrics. pgx
+// hands a private copy of the connection config to TraceConnectStart, so the
+// hooks only apply to the connect operation being traced.
+func (t *Tracer) instrumentConnect(config *pgx.ConnConfig) *connectState {
+	state := &connectState{
+		poolName:      t.connectPoolName(&config.Config),
+		hostsByAddr:   make(map[string]string),
+		hosts:         make([]pgconn.FallbackConfig, 0, len(config.Fallbacks)+1),
+		fallbackIndex: -1,
+	}
+
+	state.hosts = append(state.hosts, pgconn.FallbackConfig{Host: config.Host, Port: config.Port})
+	for _, fallback := range config.Fallbacks {
+		state.hosts = append(state.hosts, *fallback)
+	}
+
+	if lookupFunc := config.LookupFunc; lookupFunc != nil {
+		config.LookupFunc = func(ctx context.Context, host string) ([]string, error) {
+			if state.finished() {
+				return lookupFunc(ctx, host)
+			}
+
+			start := time.Now()
+			ctx, span := t.startConnectPhaseSpan(ctx, "connect.lookup", semconv.ServerAddress(host))
+
+			addrs, err := lookupFunc(ctx, host)
+			t.endConnectPhase(ctx, span, state, connectPhaseLookup, start, err)
+
+			state.mu.Lock()
+			for _, addr := range addrs {
+				if ip, _, err := net.SplitHostPort(addr); err == nil {
+					addr = ip
+				}
+				state.hostsByAddr[addr] = host
+			}
+			state.mu.Unlock()
+
+			return addrs, err
+		}
+	}
+
+	if dialFunc := config.DialFunc; dialFunc != nil {
+		config.DialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if state.finished() {
+				return dialFunc(ctx, network, addr)
+			}
+
+			state.setServer(network, addr)
+
+			start := time.Now()
+			ctx, span := t.startConnectPhaseSpan(ctx, "connect.dial", dialAttributes(network, addr)...)
+
+			conn, err := dialFunc(ctx, network, addr)
+			t.endConnectPhase(ctx, span, state, connectPhaseDial, start, err)
+
+			state.mu.Lock()
+			state.dialedAt = time.Now()
+			state.mu.Unlock()
+
+			return conn, err
+		}
+	}
+
+	afterNetConnect := config.AfterNetConnect
+	config.AfterNetConnect = func(ctx context.Context, cfg *pgconn.Config, conn net.Conn) (net.Conn, error) {
+		state.mu.Lock()
+		dialedAt := state.dialedAt
+		state.netConnectedAt = time.Now()
+		state.mu.Unlock()
+
+		if tlsConn, ok := conn.(*tls.Conn); ok {
+			t.recordTLSHandshake(ctx, state, tlsConn.ConnectionState(), dialedAt)
+		}
+
+		if afterNetConnect != nil {
+			var err error
+			if conn, err = afterNetConnect(ctx, cfg, conn); err != nil {
+				return conn, err
+			}
+		}
+
+		state.mu.Lock()
+		state.sniffer = &sniffingReader{
+			tracer:         t,
+			state:          state,
+			span:           trace.SpanFromContext(ctx),
+			trackResponses: t.timeToFirstRow,
+		}
+		state.mu.Unlock()
+
+		return conn, nil
+	}
+
+	// The messages are inspected above the reader of the connection rather
+	// than by wrapping the net.Conn, so that pgconn still sees a *tls.Conn,
+	// e.g. for SCRAM channel binding.
+	if buildFrontend := config.BuildFrontend; buildFrontend != nil {
+		config.BuildFrontend = func(r io.Reader, w io.Writer) *pgproto3.Frontend {
+			state.mu.Lock()
+			defer state.mu.Unlock()
+
+			// A frontend built again for a hijacked connection is not
+			// inspected, as it is already authenticated.
+			if sniffer := state.sniffer; sniffer != nil && sniffer.Reader == nil {
+				sniffer.Reader = r
+				r = sniffer
+			}
+			return buildFrontend(r, w)
+		}
+	}
+
+	return state
+}
+
+// startConnectPhaseSpan starts a child span of the connect span in ctx, if it
+// is recording.
+func (t *Tracer) startConnectPhaseSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if !t.enabled(pgxOperationConnect, InstrumentationSpans) || !trace.SpanFromContext(ctx).IsRecording() {
+		return ctx, nil
+	}
+
+	return t.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// endConnectPhase records the duration of a connect phase which started at
+// start and ends its span, if any.
+func (t *Tracer) endConnectPhase(ctx context.Context, span trace.Span, state *connectState, phase string, start time.Time, err error) {
+	t.recordConnectPhaseDuration(ctx, state, phase, time.Since(start), err)
+
+	if span != nil {
+		t.recordSpanError(span, pgxOperationConnect, err)
+		span.End()
+	}
+}
+
+// recordConnectPhaseDuration records the duration of a connect phase in the
+// db.client.connection.phase.duration histogram.
+func (t *Tracer) recordConnectPhaseDuration(ctx context.Context, state *connectState, phase string, elapsed time.Duration, err error) {
+	if !t.enabled(pgxOperationConnect, InstrumentationMetrics) {
+		return
+	}
+
+	attrs := withAttributes(t.meterAttrs,
+		ConnectPhaseKey.String(phase),
+		semconv.DBClientConnectionPoolName(state.poolName),
+	)
+	if err != nil {
+		attrs = append(attrs, semconv.ErrorTypeKey.String(t.errorType(err)))
+	}
+
+	t.connectPhaseDuration.Record(ctx, elapsed.Seconds(), metric.WithAttributeSet(attribute.NewSet(attrs...)))
+}
+
+// recordTLSHandshake records the TLS handshake which completed after the dial
+// at dialedAt as an event on the connect span in ctx.
+func (t *Tracer) recordTLSHandshake(ctx context.Context, state *connectState, cs tls.ConnectionState, dialedAt time.Time) {
+	if !dialedAt.IsZero() {
+		t.recordConnectPhaseDuration(ctx, state, connectPhaseTLS, time.Since(dialedAt), nil)
+	}
+
+	span := trace.SpanFromContext(ctx)
+	if !t.connectEventsEnabled() || !span.IsRecording() {
+		return
+	}
+
+	version := tls.VersionName(cs.Version)
+	span.AddEvent("tls.handshake", trace.WithAttributes(
+		semconv.TLSProtocolNameTLS,
+		semconv.TLSProtocolVersion(strings.TrimPrefix(version, "TLS ")),
+		semconv.TLSCipher(tls.CipherSuiteName(cs.CipherSuite)),
+		semconv.TLSResumed(cs.DidResume),
+	))
+}
+
+// connectEventsEnabled reports whether events are recorded on connect spans.
+// The span in the context of the connect phases is only the connect span if
+// connect spans are enabled.
+func (t *Tracer) connectEventsEnabled() bool {
+	return t.instrumentation[pgxOperationConnect]&(InstrumentationSpans|InstrumentationEvents) ==
+		InstrumentationSpans|InstrumentationEvents
+}
+
+// recordAuthenticated records the successful authentication of the current
+// connection attempt as an event on span.
+func (t *Tracer) recordAuthenticated(state *connectState, span trace.Span) {
+	state.mu.Lock()
+	state.authenticatedAt = time.Now()
+	netConnectedAt := state.netConnectedAt
+	method := state.authMethod
+	state.mu.Unlock()
+
+	t.recordConnectPhaseDuration(context.Background(), state, connectPhaseAuth, time.Since(netConnectedAt), nil)
+
+	if span != nil && t.connectEventsEnabled() && span.IsRecording() {
+		span.AddEvent("authenticated", trace.WithAttributes(ConnectAuthMethodKey.String(method)))
+	}
+}
+
+// recordStartup records the duration from the successful authentication to
+// the completion of the connect operation.
+func (t *Tracer) recordStartup(ctx context.Context, state *connectState) {
+	state.mu.Lock()
+	authenticatedAt := state.authenticatedAt
+	state.mu.Unlock()
+
+	if !authenticatedAt.IsZero() {
+		t.recordConnectPhaseDuration(ctx, state, connectPhaseStartup, time.Since(authenticatedAt), nil)
+	}
+}
+
+// dialAttributes returns the attributes of a dial to addr.
+func dialAttributes(network, addr string) []attribute.KeyValue {
+	if network == "unix" {
+		return []attribute.KeyValue{semconv.NetworkTransportUnix, semconv.NetworkPeerAddress(addr)}
+	}
+
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return []attribute.KeyValue{semconv.NetworkPeerAddress(addr)}
+	}
+
+	attrs := []attribute.KeyValue{semconv.NetworkTransportTCP, semconv.NetworkPeerAddress(host)}
+	if port, err := strconv.Atoi(portStr); err == nil {
+		attrs = append(attrs, semconv.NetworkPeerPort(port))
+	}
+	return attrs
+}
+
+// finish marks the connect operation as ended.
+func (s *connectState) finish() {
+	s.mu.Lock()
+	s.done = true
+	s.mu.Unlock()
+}
+
+// finished reports whether the connect operation has ended.
+func (s *connectState) finished() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done
+}
+
+// setServer records the server which is about to be dialed, starting a new
+// connection attempt.
+func (s *connectState) setServer(network, addr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.authMethod = ""
+	s.dialedAt, s.netConnectedAt, s.authenticatedAt = time.Time{}, time.Time{}, time.Time{}
+
+	if network == "unix" {
+		s.serverAddress, s.serverPort = addr, 0
+		s.fallbackIndex = s.hostIndex(network, addr)
+		return
+	}
+
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		s.serverAddress, s.serverPort = addr, 0
+		s.fallbackIndex = -1
+		return
+	}
+
+	port, _ := strconv.Atoi(portStr)
+	if configured, ok := s.hostsByAddr[host]; ok {
+		host = configured
+	}
+
+	s.serverAddress, s.serverPort = host, port
+	s.fallbackIndex = s.hostIndex(network, net.JoinHostPort(host, portStr))
+}
+
+// hostIndex returns the index of the first configured host with the given
+// network address, or -1 if there is none. Hosts which are configured more
+// than once, e.g. with and without TLS, always match their first entry.
+func (s *connectState) hostIndex(network, addr string) int {
+	for i, host := range s.hosts {
+		if n, a := pgconn.NetworkAddress(host.Host, host.Port); n == network && a == addr {
+			return i
+		}
+	}
+	return -1
+}
+
+// setAuthMethod records the authentication method requested first by the
+// server.
+func (s *connectState) setAuthMethod(method string) {
+	s.mu.Lock()
+	if s.authMethod == "" {
+		s.authMethod = method
+	}
+	s.mu.Unlock()
+}
+
+// server returns the address and port of the server which was connected to
+// last.
+func (s *connectState) server() (string, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.serverAddress, s.serverPort
+}
+
+// spanAttributes returns the attributes describing which of the configured
+// hosts was connected to last.
+func (s *connectState) spanAttributes() []attribute.KeyValue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fallbackIndex < 0 {
+		return nil
+	}
+	return []attribute.KeyValue{ConnectFallbackIndexKey.Int(s.fallbackIndex)}
+}
+
+// attributes returns the attributes describing the server which was
+// connected to last, and the authentication method it requested.
+func (s *connectState) attributes() []attribute.KeyValue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var attrs []attribute.KeyValue
+	if s.serverAddress != "" {
+		attrs = append(attrs, semconv.ServerAddress(s.serverAddress))
+	}
+	if s.serverPort != 0 {
+		attrs = append(attrs, semconv.ServerPort(s.serverPort))
+	}
+	if s.authMethod != "" {
+		attrs = append(attrs, ConnectAuthMethodKey.String(s.authMethod))
+	}
+
+	return attrs
+}
+
+// sniffingReader is an io.Reader which inspects the messages received from
+// the server. It determines the requested authentication method and when
+// authentication completes, and if enabled with WithTimeToFirstRow, when the
+// rows of the query in progress arrive. Otherwise, reads are passed through
+// unchanged once authentication has completed.
+type sniffingReader struct {
+	io.Reader
+
+	tracer *Tracer
+	state  *connectState
+	span   trace.Span
+
+	// trackResponses enables inspecting messages after authentication.
+	trackResponses bool
+	// active is the query in progress on the connection, see
+	// startResponseTiming.
+	active atomic.Pointer[operation]
+
+	authenticated bool
+	done          bool
+	buf           []byte
+	skip          int
+}
+
+func (c *sniffingReader) Read(b []byte) (int, error) {
+	n, err := c.Reader.Read(b)
+	if !c.done && n > 0 {
+		c.sniff(b[:n])
+	}
+	return n, err
+}
+
+// sniff decodes the headers of the backend messages in b, buffering partial
+// headers across reads.
+func (c *sniffingReader) sniff(b []byte) {
+	for len(b) > 0 && !c.done {
+		if c.skip > 0 {
+			n := min(len(b), c.skip)
+			c.skip -= n
+			b = b[n:]
+			continue
+		}
+
+		headerLen := c.headerLen()
+		n := min(len(b), headerLen-len(c.buf))
+		c.buf = append(c.buf, b[:n]...)
+		b = b[n:]
+
+		if len(c.buf) < c.headerLen() {
+			continue
+		}
+
+		// The length includes itself, but not the message type.
+		msgType := c.buf[0]
+		c.skip = int(binary.BigEndian.Uint32(c.buf[1:5])) - (len(c.buf) - 1)
+		var requestType uint32
+		if msgType == 'R' {
+			requestType = binary.BigEndian.Uint32(c.buf[5:9])
+		}
+		c.buf = c.buf[:0]
+
+		c.handle(msgType, requestType)
+	}
+
+	if c.done {
+		c.buf = nil
+	}
+}
+
+// headerLen returns the length of the header of the message being buffered.
+// Every message starts with the type byte and an int32 length.
+// AuthenticationRequest messages during authentication are followed by the
+// int32 authentication request type.
+func (c *sniffingReader) headerLen() int {
+	if !c.authenticated && len(c.buf) > 0 && c.buf[0] == 'R' {
+		return 9
+	}
+	return 5
+}
+
+// handle processes a backend message of the given type.
+func (c *sniffingReader) handle(msgType byte, requestType uint32) {
+	if !c.authenticated {
+		if msgType != 'R' {
+			// Authentication failed, or the message is unexpected.
+			c.done = true
+			return
+		}
+
+		if method, ok := authMethods[requestType]; ok {
+			c.state.setAuthMethod(method)
+		}
+		if requestType == 0 {
+			// AuthenticationOk
+			c.tracer.recordAuthenticated(c.state, c.span)
+			c.authenticated = true
+			c.done = !c.trackResponses
+
+			// The reader lives as long as the connection, which must not keep
+			// the connect operation alive.
+			c.state, c.span = nil, nil
+		}
+		return
+	}
+
+	if m := c.active.Load(); m != nil {
+		m.handleResponse(msgType)
+	}
+}
+
+// serverIdentityAttributes returns the attributes identifying the server and
+// backend process of conn. They are captured once and cached with the
+// connection.
+func serverIdentityAttributes(conn *pgx.Conn) []attribute.KeyValue {
+	pgConn := conn.PgConn()
+	if pgConn == nil {
+		return nil
+	}
+
+	data := pgConn.CustomData()
+	if attrs, ok := data[serverIdentityDataKey].([]attribute.KeyValue); ok {
+		return attrs
+	}
+
+	attrs := make([]attribute.KeyValue, 0, len(serverParameters)+1)
+	for _, param := range serverParameters {
+		if value := pgConn.ParameterStatus(param.name); value != "" {
+			attrs = append(attrs, param.key.String(value))
+		}
+	}
+	if pid := pgConn.PID(); pid != 0 {
+		attrs = append(attrs, BackendPIDKey.Int64(int64(pid)))
+	}
+
+	if data != nil {
+		data[serverIdentityDataKey] = attrs
+	}
+	return attrs
+}
+
+// connectionAttributes returns the attributes describing the server conn is
+// connected to. The server address is the configured host which was actually
+// connected to, including fallbacks, if the connection was established with
+// this tracer. The attributes are computed once and cached with the
+// connection.
+func connectionAttributes(conn *pgx.Conn) []attribute.KeyValue {
+	pgConn := conn.PgConn()
+	if pgConn == nil {
+		return connectionAttributesFromConfig(conn.Config())
+	}
+
+	data := pgConn.CustomData()
+	if attrs, ok := data[connectionAttributesDataKey].([]attribute.KeyValue); ok {
+		return attrs
+	}
+
+	attrs := connectionAttributesFromConfig(conn.Config())
+	if netConn := pgConn.Conn(); netConn != nil {
+		attrs = append(attrs, peerAttributes(netConn.RemoteAddr())...)
+	}
+
+	if data != nil {
+		data[connectionAttributesDataKey] = attrs
+	}
+	return attrs
+}
+
+// cacheSniffer stores the sniffingReader of the connection attempt which
+// established conn with the connection, if it tracks the responses to queries,
+// see startResponseTiming.
+func cacheSniffer(conn *pgx.Conn, state *connectState) {
+	state.mu.Lock()
+	sniffer := state.sniffer
+	state.mu.Unlock()
+
+	if sniffer == nil || !sniffer.trackResponses {
+		return
+	}
+	if pgConn := conn.PgConn(); pgConn != nil && pgConn.CustomData() != nil {
+		pgConn.CustomData()[snifferDataKey] = sniffer
+	}
+}
+
+// cacheConnectionAttributes computes the connection attributes of a newly
+// established connection, replacing the configured server with the one which
+// was actually connected to.
+func cacheConnectionAttributes(conn *pgx.Conn, state *connectState) []attribute.KeyValue {
+	attrs := connectionAttributes(conn)
+
+	address, port := state.server()
+	if address == "" {
+		return attrs
+	}
+
+	attrs = slices.Clone(attrs)
+	for i, kv := range attrs {
+		switch kv.Key {
+		case semconv.ServerAddressKey:
+			attrs[i] = semconv.ServerAddress(address)
+		case semconv.ServerPortKey:
+			if port != 0 {
+				attrs[i] = semconv.ServerPort(port)
+			}
+		}
+	}
+
+	if data := conn.PgConn().CustomData(); data != nil {
+		data[connectionAttributesDataKey] = attrs
+	}
+	return attrs
+}
+
+// peerAttributes returns the network attributes of the peer address addr.
+func peerAttributes(addr net.Addr) []attribute.KeyValue {
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		return []attribute.KeyValue{
+			semconv.NetworkTransportTCP,
+			semconv.NetworkPeerAddress(addr.IP.String()),
+			semconv.NetworkPeerPort(addr.Port),
+		}
+	case *net.UnixAddr:
+		attrs := []attribute.KeyValue{semconv.NetworkTransportUnix}
+		if addr.Name != "" {
+			attrs = append(attrs, semconv.NetworkPeerAddress(addr.Name))
+		}
+		return attrs
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,432 @@
+package otelpgx
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+)
+
+func TestTracer_connectionCreateTime(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	tracer := NewTracer(WithMeterProvider(mp))
+
+	newMockConn(t, "fakehost", 5432, "fakeuser", "fakedb", func(config *pgx.ConnConfig) {
+		config.LookupFunc = func(context.Context, string) ([]string, error) {
+			return []string{"10.0.0.1"}, nil
+		}
+		config.Tracer = tracer
+	})
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	m, ok := findMetric(rm, "db.client.connection.create_time")
+	require.True(t, ok, "missing db.client.connection.create_time metric")
+	hist := m.Data.(metricdata.Histogram[float64])
+	require.Len(t, hist.DataPoints, 1)
+
+	attrs := hist.DataPoints[0].Attributes
+	for key, want := range map[attribute.Key]string{
+		semconv.ServerAddressKey:              "fakehost",
+		semconv.DBClientConnectionPoolNameKey: "fakehost:5432/fakedb",
+		semconv.DBSystemNameKey:               "postgresql",
+		ConnectAuthMethodKey:                  "trust",
+	} {
+		v, ok := attrs.Value(key)
+		require.Truef(t, ok, "missing attribute %q", key)
+		require.Equal(t, want, v.AsString())
+	}
+
+	port, ok := attrs.Value(semconv.ServerPortKey)
+	require.True(t, ok)
+	require.Equal(t, int64(5432), port.AsInt64())
+
+	_, ok = attrs.Value(semconv.ErrorTypeKey)
+	require.False(t, ok, "unexpected error.type attribute")
+}
+
+func TestTracer_connectPoolName(t *testing.T) {
+	register := func(opts ...StatsOption) *StatsRegistration {
+		reg, err := RegisterStats(newTestPool(t, "postgres://fakeuser@poolhost:5432/fakedb"), opts...)
+		require.NoError(t, err)
+		return reg
+	}
+
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	tracer := NewTracer(WithMeterProvider(mp))
+
+	primary := register(WithStatsMeterProvider(mp), WithStatsPoolName("primary"))
+	t.Cleanup(func() { require.NoError(t, primary.Unregister()) })
+
+	newMockConn(t, "poolhost", 5432, "fakeuser", "fakedb", func(config *pgx.ConnConfig) {
+		config.LookupFunc = func(context.Context, string) ([]string, error) {
+			return []string{"10.0.0.1"}, nil
+		}
+		tracer.InstrumentDialFunc(&config.Config)
+		config.Tracer = tracer
+	})
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	for _, name := range []string{"db.client.connection.create_time", "db.client.network.io"} {
+		m, ok := findMetric(rm, name)
+		require.Truef(t, ok, "missing %s metric", name)
+
+		var attrs []attribute.Set
+		switch data := m.Data.(type) {
+		case metricdata.Histogram[float64]:
+			for _, dp := range data.DataPoints {
+				attrs = append(attrs, dp.Attributes)
+			}
+		case metricdata.Sum[int64]:
+			for _, dp := range data.DataPoints {
+				attrs = append(attrs, dp.Attributes)
+			}
+		}
+		require.NotEmpty(t, attrs)
+		for _, set := range attrs {
+			v, _ := set.Value(semconv.DBClientConnectionPoolNameKey)
+			require.Equalf(t, "primary", v.AsString(), "pool name of %s", name)
+		}
+	}
+
+	// Connections cannot be told apart once several registered pools share the
+	// derived name, unless the Tracer is dedicated to a pool.
+	replica := register(WithStatsMeterProvider(mp), WithStatsPoolName("replica"))
+	config := &pgconn.Config{Host: "poolhost", Port: 5432, Database: "fakedb"}
+	require.Equal(t, "poolhost:5432/fakedb", tracer.connectPoolName(config))
+	require.Equal(t, "replica", NewTracer(WithPoolName("replica")).connectPoolName(config))
+
+	require.NoError(t, replica.Unregister())
+	require.Equal(t, "primary", tracer.connectPoolName(config))
+}
+
+func TestTracer_connectionFallback(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	tracer := NewTracer(WithTracerProvider(tp))
+
+	conn := newMockConn(t, "primary", 5432, "fakeuser", "fakedb", func(config *pgx.ConnConfig) {
+		config.Fallbacks = []*pgconn.FallbackConfig{{Host: "replica", Port: 5433}}
+
+		dialFunc := config.DialFunc
+		config.DialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if addr == "primary:5432" {
+				return nil, errors.New("connection refused")
+			}
+			return dialFunc(ctx, network, addr)
+		}
+		config.Tracer = tracer
+	})
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	ctx = tracer.TraceQueryStart(ctx, conn, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	tracer.TraceQueryEnd(ctx, conn, pgx.TraceQueryEndData{})
+	parent.End()
+
+	spans := sr.Ended()
+	require.Len(t, spans, 2)
+	attrs := attribute.NewSet(spans[0].Attributes()...)
+
+	address, ok := attrs.Value(semconv.ServerAddressKey)
+	require.True(t, ok)
+	require.Equal(t, "replica", address.AsString())
+	port, ok := attrs.Value(semconv.ServerPortKey)
+	require.True(t, ok)
+	require.Equal(t, int64(5433), port.AsInt64())
+}
+
+func TestConnectState_fallbackIndex(t *testing.T) {
+	config, err := pgx.ParseConfig("host=primary,replica,/tmp port=5432,5433,5434 user=user dbname=db sslmode=disable")
+	require.NoError(t, err)
+
+	state := NewTracer().instrumentConnect(config)
+	state.hostsByAddr["10.0.0.2"] = "replica"
+
+	tests := []struct {
+		network, addr string
+		want          []attribute.KeyValue
+	}{
+		{network: "tcp", addr: "primary:5432", want: []attribute.KeyValue{ConnectFallbackIndexKey.Int(0)}},
+		{network: "tcp", addr: "10.0.0.2:5433", want: []attribute.KeyValue{ConnectFallbackIndexKey.Int(1)}},
+		{network: "unix", addr: "/tmp/.s.PGSQL.5434", want: []attribute.KeyValue{ConnectFallbackIndexKey.Int(2)}},
+		{network: "tcp", addr: "unknown:5432"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			state.setServer(tt.network, tt.addr)
+			require.Equal(t, tt.want, state.spanAttributes())
+		})
+	}
+}
+
+func TestPeerAttributes(t *testing.T) {
+	require.Equal(t, []attribute.KeyValue{
+		semconv.NetworkTransportTCP,
+		semconv.NetworkPeerAddress("10.0.0.1"),
+		semconv.NetworkPeerPort(5432),
+	}, peerAttributes(&net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5432}))
+
+	require.Equal(t, []attribute.KeyValue{
+		semconv.NetworkTransportUnix,
+		semconv.NetworkPeerAddress("/tmp/.s.PGSQL.5432"),
+	}, peerAttributes(&net.UnixAddr{Name: "/tmp/.s.PGSQL.5432", Net: "unix"}))
+}
+
+func TestTracer_connectPhases(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	tracer := NewTracer(WithMeterProvider(mp))
+
+	conn := newMockConn(t, "fakehost", 5432, "fakeuser", "fakedb", func(config *pgx.ConnConfig) {
+		config.Tracer = tracer
+	})
+
+	// Without WithTimeToFirstRow, the sniffer is not kept with the connection.
+	_, ok := conn.PgConn().CustomData()[snifferDataKey]
+	require.False(t, ok, "unexpected sniffer")
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	m, ok := findMetric(rm, string(DBClientConnectionPhaseDurationKey))
+	require.True(t, ok, "missing %s metric", DBClientConnectionPhaseDurationKey)
+
+	var phases []string
+	for _, dp := range m.Data.(metricdata.Histogram[float64]).DataPoints {
+		phase, ok := dp.Attributes.Value(ConnectPhaseKey)
+		require.True(t, ok)
+		phases = append(phases, phase.AsString())
+	}
+	require.ElementsMatch(t, []string{"lookup", "dial", "auth", "startup"}, phases)
+}
+
+func TestTracer_cancelRequestAfterConnect(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	tracer := NewTracer(WithTracerProvider(tp), WithMeterProvider(mp))
+
+	var dials int
+	conn := newMockConn(t, "fakehost", 5432, "fakeuser", "fakedb", func(config *pgx.ConnConfig) {
+		dialFunc := config.DialFunc
+		config.DialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if dials++; dials == 1 {
+				return dialFunc(ctx, network, addr)
+			}
+
+			// Accept the cancel request on a connection of its own.
+			client, server := net.Pipe()
+			go func() {
+				defer server.Close()
+				_, _ = io.ReadFull(server, make([]byte, 16))
+			}()
+			return client, nil
+		}
+		config.Tracer = tracer
+	})
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	require.NoError(t, conn.PgConn().CancelRequest(ctx))
+	parent.End()
+	require.Equal(t, 2, dials)
+
+	for _, span := range sr.Ended() {
+		require.NotEqual(t, "connect.dial", span.Name(), "cancel request recorded as connect phase")
+	}
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	m, ok := findMetric(rm, string(DBClientConnectionPhaseDurationKey))
+	require.True(t, ok, "missing %s metric", DBClientConnectionPhaseDurationKey)
+	for _, dp := range m.Data.(metricdata.Histogram[float64]).DataPoints {
+		require.Equal(t, uint64(1), dp.Count)
+	}
+}
+
+func TestTracer_connectTLS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"fakehost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+
+	client, server := net.Pipe()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- func() error {
+			defer server.Close()
+
+			if _, err := pgproto3.NewBackend(server, server).ReceiveStartupMessage(); err != nil {
+				return fmt.Errorf("receive SSL request: %w", err)
+			}
+			if _, err := server.Write([]byte{'S'}); err != nil {
+				return fmt.Errorf("accept SSL request: %w", err)
+			}
+
+			tlsConn := tls.Server(server, &tls.Config{Certificates: []tls.Certificate{cert}})
+			b := pgproto3.NewBackend(tlsConn, tlsConn)
+			if _, err := b.ReceiveStartupMessage(); err != nil {
+				return fmt.Errorf("receive startup: %w", err)
+			}
+			b.Send(&pgproto3.AuthenticationOk{})
+			b.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+			if err := b.Flush(); err != nil {
+				return fmt.Errorf("flush: %w", err)
+			}
+
+			for {
+				if _, err := b.Receive(); err != nil {
+					return nil
+				}
+			}
+		}()
+	}()
+
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	tracer := NewTracer(WithTracerProvider(tp), WithTimeToFirstRow())
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	defer parent.End()
+
+	config, err := pgx.ParseConfig("postgres://fakeuser@fakehost:5432/fakedb?sslmode=require")
+	require.NoError(t, err)
+	config.LookupFunc = func(context.Context, string) ([]string, error) {
+		return []string{"10.0.0.1"}, nil
+	}
+	config.DialFunc = func(context.Context, string, string) (net.Conn, error) {
+		return client, nil
+	}
+	config.Tracer = tracer
+
+	conn, err := pgx.ConnectConfig(ctx, config)
+	require.NoError(t, err)
+
+	// pgconn relies on the connection being a *tls.Conn, e.g. for SCRAM
+	// channel binding, so it must not be wrapped.
+	_, ok := conn.PgConn().Conn().(*tls.Conn)
+	require.True(t, ok, "connection is a %T, want *tls.Conn", conn.PgConn().Conn())
+
+	_, ok = conn.PgConn().CustomData()[snifferDataKey].(*sniffingReader)
+	require.True(t, ok, "missing sniffer")
+
+	require.NoError(t, conn.Close(context.Background()))
+	require.NoError(t, <-errCh)
+
+	var events []sdktrace.Event
+	for _, span := range sr.Ended() {
+		if span.Name() == "connect" {
+			events = span.Events()
+		}
+	}
+
+	i := slices.IndexFunc(events, func(e sdktrace.Event) bool { return e.Name == "authenticated" })
+	require.GreaterOrEqual(t, i, 0, "missing authenticated event")
+	method, ok := findAttr(events[i].Attributes, string(ConnectAuthMethodKey))
+	require.True(t, ok, "missing %s attribute", ConnectAuthMethodKey)
+	require.Equal(t, "trust", method.AsString())
+}
+
+func TestSniffingReader_sniff(t *testing.T) {
+	authRequest := func(requestType uint32, data string) []byte {
+		msg := []byte{'R', 0, 0, 0, 0, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(msg[1:5], uint32(8+len(data)))
+		binary.BigEndian.PutUint32(msg[5:9], requestType)
+		return append(msg, data...)
+	}
+
+	var stream []byte
+	stream = append(stream, authRequest(10, "SCRAM-SHA-256\x00\x00")...)
+	stream = append(stream, authRequest(11, "r=nonce,s=salt,i=4096")...)
+	stream = append(stream, authRequest(12, "v=signature")...)
+	stream = append(stream, authRequest(0, "")...)
+	stream = append(stream, 'S', 0, 0, 0, 4)
+
+	state := &connectState{}
+	c := &sniffingReader{tracer: NewTracer(), state: state}
+
+	// Feed the stream in small chunks to split messages across reads.
+	for i := 0; i < len(stream); i += 3 {
+		c.sniff(stream[i:min(i+3, len(stream))])
+	}
+
+	require.True(t, c.done)
+	require.Equal(t, "scram", state.authMethod)
+	require.False(t, state.authenticatedAt.IsZero())
+	require.Nil(t, c.state, "connect state kept after authentication")
+}
+
+func TestSniffingReader_responses(t *testing.T) {
+	message := func(msgType byte, data string) []byte {
+		msg := []byte{msgType, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(msg[1:5], uint32(4+len(data)))
+		return append(msg, data...)
+	}
+
+	c := &sniffingReader{tracer: NewTracer(), state: &connectState{}, trackResponses: true}
+	c.sniff([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+	require.True(t, c.authenticated)
+	require.False(t, c.done)
+
+	m := &operation{}
+	c.active.Store(m)
+
+	c.sniff(message('T', "\x00\x01column"))
+	require.True(t, m.firstRowAt.IsZero())
+
+	// The first of multiple statements completes before the result does.
+	var stream []byte
+	stream = append(stream, message('D', "\x00\x01\x00\x00\x00\x011")...)
+	stream = append(stream, message('D', "\x00\x01\x00\x00\x00\x012")...)
+	stream = append(stream, message('C', "SELECT 2\x00")...)
+	stream = append(stream, message('C', "UPDATE 1\x00")...)
+	for i := 0; i < len(stream); i += 3 {
+		c.sniff(stream[i:min(i+3, len(stream))])
+	}
+	require.False(t, m.firstRowAt.IsZero())
+	require.True(t, m.completedAt.IsZero())
+
+	c.sniff(message('Z', "I"))
+
+	require.False(t, m.firstRowAt.IsZero())
+	require.False(t, m.completedAt.IsZero())
+	require.False(t, m.completedAt.Before(m.firstRowAt))
+	require.Empty(t, c.buf)
+}
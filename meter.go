@@ -3,14 +3,17 @@ package otelpgx
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"sync"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
 	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	dbconv "go.opentelemetry.io/otel/semconv/v1.40.0/dbconv"
 )
 
 const (
@@ -37,20 +40,66 @@ const (
 // RecordStats records database statistics for provided [pgxpool.Pool] at a default 1 second interval
 // unless otherwise specified by the WithMinimumReadDBStatsInterval StatsOption.
 //
+// The pgxpool.acquire_duration and pgxpool.empty_acquire_wait_time metrics are
+// cumulative totals. For latency distributions use the
+// db.client.connection.wait_time histogram recorded by the [Tracer] instead.
+//
+// By default, all statistics are exported using the pgxpool.* metric names. The
+// WithStatsNaming StatsOption selects between these and the names following the
+// OpenTelemetry database semantic conventions (db.client.connection.*), or both.
+// WithStatsGroups and WithStatsDisabledMetrics restrict the exported metrics,
+// and WithStatsNamePrefix prefixes their names.
+//
+// The db.client.connection.pool.name attribute defaults to
+// server.address:server.port/db.namespace. If several pools registered with the
+// same meter provider would share that name, a "#2", "#3", ... suffix is
+// appended for every further pool. Use WithStatsPoolName to name pools
+// explicitly instead.
+//
 // Attributes provided via WithStatsAttributes override the library-supplied defaults
 // (db.system.name, db.client.connection.pool.name) on key collision, since
 // attribute.NewSet applies last-value-wins semantics over the resulting slice.
+//
+// The statistics are recorded for the lifetime of the meter provider. Use
+// [RegisterStats] for pools which are closed before that.
 func RecordStats(db PoolStats, opts ...StatsOption) error {
-	connCfg := db.Config().ConnConfig
-	poolName := fmt.Sprintf("%s:%d/%s", connCfg.Host, connCfg.Port, connCfg.Database)
+	_, err := RegisterStats(db, opts...)
+	return err
+}
+
+// StatsRegistration is a handle to the statistics recording of a single pool
+// started by [RegisterStats].
+type StatsRegistration struct {
+	recorder *statsRecorder
+	pool     *registeredPool
+	once     sync.Once
+	err      error
+}
+
+// Unregister stops recording the statistics of the pool. It is safe to call
+// Unregister multiple times; only the first call has an effect.
+//
+// pgxpool does not signal when a pool is closed, so Unregister should be called
+// whenever the pool is closed, e.g. on tenant removal or credential rotation.
+// Otherwise, the closed pool keeps being observed.
+func (r *StatsRegistration) Unregister() error {
+	r.once.Do(func() {
+		r.err = r.recorder.remove(r.pool)
+	})
+	return r.err
+}
 
+// RegisterStats behaves like [RecordStats], but returns a [StatsRegistration]
+// which allows to stop recording the statistics, e.g. once the pool is closed.
+//
+// All pools registered with the same meter provider are observed by a single
+// shared callback.
+func RegisterStats(db PoolStats, opts ...StatsOption) (*StatsRegistration, error) {
 	o := statsOptions{
 		meterProvider:              otel.GetMeterProvider(),
 		minimumReadDBStatsInterval: defaultMinimumReadDBStatsInterval,
-		defaultAttributes: []attribute.KeyValue{
-			semconv.DBSystemNamePostgreSQL,
-			semconv.DBClientConnectionPoolName(poolName),
-		},
+		naming:                     StatsNamingLegacy,
+		groups:                     StatsGroupAll,
 	}
 
 	for _, opt := range opts {
@@ -59,7 +108,58 @@ func RecordStats(db PoolStats, opts ...StatsOption) error {
 
 	meter := o.meterProvider.Meter(meterName, metric.WithInstrumentationVersion(findOwnImportedVersion()))
 
-	return recordStats(meter, db, o.minimumReadDBStatsInterval, o.defaultAttributes...)
+	recorder, pool, err := registerPool(meter, db, &o)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StatsRegistration{recorder: recorder, pool: pool}, nil
+}
+
+// poolNameFromConfig derives the db.client.connection.pool.name of a pool from
+// its connection config, formatted as server.address:server.port/db.namespace.
+func poolNameFromConfig(cfg *pgxpool.Config) string {
+	return poolNameFromConnConfig(&cfg.ConnConfig.Config)
+}
+
+// poolNameFromConnConfig derives the db.client.connection.pool.name from a
+// connection config, formatted as server.address:server.port/db.namespace.
+func poolNameFromConnConfig(connCfg *pgconn.Config) string {
+	return fmt.Sprintf("%s:%d/%s", connCfg.Host, connCfg.Port, connCfg.Database)
+}
+
+// registeredPools maps pools registered via RegisterStats to their
+// registration, so that the [Tracer] uses the same pool name for its metrics.
+var registeredPools sync.Map // map[PoolStats]*poolRegistration
+
+// poolRegistration is the registration of a pool via RegisterStats.
+type poolRegistration struct {
+	name string
+
+	// derivedName is the name derived from the configuration of the pool.
+	derivedName string
+
+	// attrs caches the metric attribute sets of the pool per Tracer. They are
+	// dropped along with the registration once the pool is unregistered.
+	attrs sync.Map // map[*Tracer]*poolAttributeSets
+}
+
+// registeredPoolName returns the registered name of the pool with the given
+// derived name. If no or several registered pools share the derived name, it
+// cannot be told which pool is meant and the derived name is returned.
+func registeredPoolName(derivedName string) string {
+	name, matches := derivedName, 0
+	registeredPools.Range(func(_, v any) bool {
+		if reg := v.(*poolRegistration); reg.derivedName == derivedName {
+			name = reg.name
+			matches++
+		}
+		return matches < 2
+	})
+	if matches != 1 {
+		return derivedName
+	}
+	return name
 }
 
 // PoolStats is an interface that provides access to the pgxpool.Pool's statistics.
@@ -68,180 +168,471 @@ type PoolStats interface {
 	Config() *pgxpool.Config
 }
 
-func recordStats(
-	meter metric.Meter,
-	db PoolStats,
-	minimumReadDBStatsInterval time.Duration,
-	attrs ...attribute.KeyValue,
-) error {
-	var (
-		err error
-
-		// Asynchronous Observable Metrics
-		acquireCount            metric.Int64ObservableCounter
-		acquireDuration         metric.Int64ObservableCounter
-		acquiredConns           metric.Int64ObservableUpDownCounter
-		cancelledAcquires       metric.Int64ObservableCounter
-		constructingConns       metric.Int64ObservableUpDownCounter
-		emptyAcquires           metric.Int64ObservableCounter
-		idleConns               metric.Int64ObservableUpDownCounter
-		maxConns                metric.Int64ObservableGauge
-		maxIdleDestroyCount     metric.Int64ObservableCounter
-		maxLifetimeDestroyCount metric.Int64ObservableCounter
-		newConnsCount           metric.Int64ObservableCounter
-		totalConns              metric.Int64ObservableUpDownCounter
-		emptyAcquireWaitTime    metric.Int64ObservableCounter
-
-		observeOptions []metric.ObserveOption
-
-		dbStats     *pgxpool.Stat
-		lastDBStats time.Time
-
-		// lock prevents a race between batch observer and instrument registration.
-		lock sync.Mutex
-	)
+// instrumentKind is the kind of asynchronous instrument used for a pool statistic.
+type instrumentKind int
 
-	lock.Lock()
-	defer lock.Unlock()
+const (
+	instrumentCounter instrumentKind = iota
+	instrumentUpDownCounter
+	instrumentGauge
+)
+
+// statsObserveFunc observes a single pool statistic for inst.
+type statsObserveFunc func(obs metric.Observer, inst metric.Int64Observable, p *registeredPool, s *pgxpool.Stat)
+
+// statsMetric describes a single metric exported by RecordStats.
+type statsMetric struct {
+	name        string
+	description string
+	unit        string
+	kind        instrumentKind
+	group       StatsGroup
+	naming      StatsNaming
+	observe     statsObserveFunc
+}
 
-	if acquireCount, err = meter.Int64ObservableCounter(
-		pgxPoolAcquireCount,
-		metric.WithDescription("Cumulative count of successful acquires from the pool."),
-	); err != nil {
-		return fmt.Errorf("failed to create asynchronous metric: %s with error: %w", pgxPoolAcquireCount, err)
+// observeStat returns a statsObserveFunc observing the value returned by fn
+// with the default attributes of the pool.
+func observeStat(fn func(s *pgxpool.Stat) int64) statsObserveFunc {
+	return func(obs metric.Observer, inst metric.Int64Observable, p *registeredPool, s *pgxpool.Stat) {
+		obs.ObserveInt64(inst, fn(s), p.observeOptions...)
 	}
+}
+
+// statsMetrics lists all metrics which can be exported by RecordStats.
+var statsMetrics = []statsMetric{
+	{
+		name:        pgxPoolAcquireCount,
+		description: "Cumulative count of successful acquires from the pool.",
+		kind:        instrumentCounter,
+		group:       StatsGroupCounts,
+		naming:      StatsNamingLegacy,
+		observe:     observeStat((*pgxpool.Stat).AcquireCount),
+	},
+	{
+		name:        pgxPoolAcquireDuration,
+		description: "Total duration of all successful acquires from the pool in nanoseconds.",
+		unit:        "ns",
+		kind:        instrumentCounter,
+		group:       StatsGroupDurations,
+		naming:      StatsNamingLegacy,
+		observe:     observeStat(func(s *pgxpool.Stat) int64 { return s.AcquireDuration().Nanoseconds() }),
+	},
+	{
+		name:        pgxPoolAcquiredConnections,
+		description: "Number of currently acquired connections in the pool.",
+		kind:        instrumentUpDownCounter,
+		group:       StatsGroupConnections,
+		naming:      StatsNamingLegacy,
+		observe:     observeStat(func(s *pgxpool.Stat) int64 { return int64(s.AcquiredConns()) }),
+	},
+	{
+		name:        pgxPoolCancelledAcquires,
+		description: "Cumulative count of acquires from the pool that were canceled by a context.",
+		kind:        instrumentCounter,
+		group:       StatsGroupCounts,
+		naming:      StatsNamingLegacy,
+		observe:     observeStat((*pgxpool.Stat).CanceledAcquireCount),
+	},
+	{
+		name:        pgxPoolConstructingConnections,
+		description: "Number of connections with construction in progress in the pool.",
+		kind:        instrumentUpDownCounter,
+		group:       StatsGroupConnections,
+		naming:      StatsNamingLegacy,
+		observe:     observeStat(func(s *pgxpool.Stat) int64 { return int64(s.ConstructingConns()) }),
+	},
+	{
+		name:        pgxPoolEmptyAcquire,
+		description: "Cumulative count of successful acquires from the pool that waited for a resource to be released or constructed because the pool was empty.",
+		kind:        instrumentCounter,
+		group:       StatsGroupCounts,
+		naming:      StatsNamingLegacy,
+		observe:     observeStat((*pgxpool.Stat).EmptyAcquireCount),
+	},
+	{
+		name:        pgxPoolIdleConnections,
+		description: "Number of currently idle connections in the pool.",
+		kind:        instrumentUpDownCounter,
+		group:       StatsGroupConnections,
+		naming:      StatsNamingLegacy,
+		observe:     observeStat(func(s *pgxpool.Stat) int64 { return int64(s.IdleConns()) }),
+	},
+	{
+		name:        pgxPoolMaxConnections,
+		description: "Maximum size of the pool.",
+		kind:        instrumentGauge,
+		group:       StatsGroupConnections,
+		naming:      StatsNamingLegacy,
+		observe:     observeStat(func(s *pgxpool.Stat) int64 { return int64(s.MaxConns()) }),
+	},
+	{
+		name:        pgxPoolMaxIdleDestroyCount,
+		description: "Cumulative count of connections destroyed because they exceeded MaxConnectionsIdleTime.",
+		kind:        instrumentCounter,
+		group:       StatsGroupDestroys,
+		naming:      StatsNamingLegacy,
+		observe:     observeStat((*pgxpool.Stat).MaxIdleDestroyCount),
+	},
+	{
+		name:        pgxPoolMaxLifetimeDestroyCount,
+		description: "Cumulative count of connections destroyed because they exceeded MaxConnectionsLifetime.",
+		kind:        instrumentCounter,
+		group:       StatsGroupDestroys,
+		naming:      StatsNamingLegacy,
+		observe:     observeStat((*pgxpool.Stat).MaxLifetimeDestroyCount),
+	},
+	{
+		name:        pgxPoolNewConnectionsCount,
+		description: "Cumulative count of new connections opened.",
+		kind:        instrumentCounter,
+		group:       StatsGroupCounts,
+		naming:      StatsNamingLegacy,
+		observe:     observeStat((*pgxpool.Stat).NewConnsCount),
+	},
+	{
+		name:        pgxPoolTotalConnections,
+		description: "Total number of resources currently in the pool. The value is the sum of ConstructingConnections, AcquiredConnections, and IdleConnections.",
+		kind:        instrumentUpDownCounter,
+		group:       StatsGroupConnections,
+		naming:      StatsNamingLegacy,
+		observe:     observeStat(func(s *pgxpool.Stat) int64 { return int64(s.TotalConns()) }),
+	},
+	{
+		name:        pgxPoolEmptyAcquireWaitTime,
+		description: "Total time waited for successful acquires from the pool for a resource to be released or constructed because the pool was empty.",
+		unit:        "ns",
+		kind:        instrumentCounter,
+		group:       StatsGroupDurations,
+		naming:      StatsNamingLegacy,
+		observe:     observeStat(func(s *pgxpool.Stat) int64 { return s.EmptyAcquireWaitTime().Nanoseconds() }),
+	},
+	{
+		name:        dbconv.ClientConnectionCount{}.Name(),
+		description: dbconv.ClientConnectionCount{}.Description(),
+		unit:        dbconv.ClientConnectionCount{}.Unit(),
+		kind:        instrumentUpDownCounter,
+		group:       StatsGroupConnections,
+		naming:      StatsNamingSemconv,
+		observe: func(obs metric.Observer, inst metric.Int64Observable, p *registeredPool, s *pgxpool.Stat) {
+			obs.ObserveInt64(inst, int64(s.IdleConns()), p.idleObserveOptions...)
+			obs.ObserveInt64(inst, int64(s.AcquiredConns()), p.usedObserveOptions...)
+		},
+	},
+	{
+		name:        dbconv.ClientConnectionMax{}.Name(),
+		description: dbconv.ClientConnectionMax{}.Description(),
+		unit:        dbconv.ClientConnectionMax{}.Unit(),
+		kind:        instrumentUpDownCounter,
+		group:       StatsGroupConnections,
+		naming:      StatsNamingSemconv,
+		observe:     observeStat(func(s *pgxpool.Stat) int64 { return int64(s.MaxConns()) }),
+	},
+	{
+		name:        dbconv.ClientConnectionIdleMin{}.Name(),
+		description: dbconv.ClientConnectionIdleMin{}.Description(),
+		unit:        dbconv.ClientConnectionIdleMin{}.Unit(),
+		kind:        instrumentUpDownCounter,
+		group:       StatsGroupConnections,
+		naming:      StatsNamingSemconv,
+		observe: func(obs metric.Observer, inst metric.Int64Observable, p *registeredPool, _ *pgxpool.Stat) {
+			obs.ObserveInt64(inst, p.minIdleConns, p.observeOptions...)
+		},
+	},
+	{
+		name:        dbconv.ClientConnectionTimeouts{}.Name(),
+		description: dbconv.ClientConnectionTimeouts{}.Description(),
+		unit:        dbconv.ClientConnectionTimeouts{}.Unit(),
+		kind:        instrumentCounter,
+		group:       StatsGroupCounts,
+		naming:      StatsNamingSemconv,
+		observe:     observeStat((*pgxpool.Stat).CanceledAcquireCount),
+	},
+}
 
-	if acquireDuration, err = meter.Int64ObservableCounter(
-		pgxPoolAcquireDuration,
-		metric.WithDescription("Total duration of all successful acquires from the pool in nanoseconds."),
-		metric.WithUnit("ns"),
-	); err != nil {
-		return fmt.Errorf("failed to create asynchronous metric: %s with error: %w", pgxPoolAcquireDuration, err)
+// enabled reports whether the metric is exported with the given options.
+func (m *statsMetric) enabled(o *statsOptions) bool {
+	if o.naming&m.naming == 0 || o.groups&m.group == 0 {
+		return false
 	}
+	_, disabled := o.disabledMetrics[m.name]
+	return !disabled
+}
 
-	if acquiredConns, err = meter.Int64ObservableUpDownCounter(
-		pgxPoolAcquiredConnections,
-		metric.WithDescription("Number of currently acquired connections in the pool."),
-	); err != nil {
-		return fmt.Errorf("failed to create asynchronous metric: %s with error: %w", pgxPoolAcquiredConnections, err)
+// createInstrument creates the asynchronous instrument for the metric, using
+// prefix in front of its name.
+func (m *statsMetric) createInstrument(meter metric.Meter, prefix string) (metric.Int64Observable, error) {
+	name := prefix + m.name
+
+	var (
+		inst metric.Int64Observable
+		err  error
+	)
+	switch m.kind {
+	case instrumentCounter:
+		inst, err = meter.Int64ObservableCounter(name, metric.WithDescription(m.description), metric.WithUnit(m.unit))
+	case instrumentUpDownCounter:
+		inst, err = meter.Int64ObservableUpDownCounter(name, metric.WithDescription(m.description), metric.WithUnit(m.unit))
+	case instrumentGauge:
+		inst, err = meter.Int64ObservableGauge(name, metric.WithDescription(m.description), metric.WithUnit(m.unit))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create asynchronous metric: %s with error: %w", name, err)
 	}
 
-	if cancelledAcquires, err = meter.Int64ObservableCounter(
-		pgxPoolCancelledAcquires,
-		metric.WithDescription("Cumulative count of acquires from the pool that were canceled by a context."),
-	); err != nil {
-		return fmt.Errorf("failed to create asynchronous metric: %s with error: %w", pgxPoolCancelledAcquires, err)
+	return inst, nil
+}
+
+// statsRecorders holds one statsRecorder per meter, so that all pools of a
+// meter provider share their instruments and a single callback. Meters which
+// cannot be used as map keys get a statsRecorder per pool instead.
+var statsRecorders = struct {
+	sync.Mutex
+	m map[metric.Meter]*statsRecorder
+}{m: make(map[metric.Meter]*statsRecorder)}
+
+// statsRecorder observes the statistics of all pools registered for a meter.
+//
+// The callback registration and the instruments are only modified while
+// holding the statsRecorders lock. They must not be modified while holding
+// lock, as the SDK invokes the callback while holding its own lock.
+type statsRecorder struct {
+	meter       metric.Meter
+	shared      bool
+	reg         metric.Registration
+	instruments map[string]metric.Int64Observable
+
+	// lock prevents a race between the observer callback and pool registration.
+	lock  sync.Mutex
+	pools []*registeredPool
+}
+
+// registeredPool is a single pool observed by a statsRecorder.
+type registeredPool struct {
+	db                         PoolStats
+	name                       string
+	registration               *poolRegistration
+	minimumReadDBStatsInterval time.Duration
+	observations               []poolObservation
+
+	// The pool config is copied on every call, so static values are read once.
+	minIdleConns int64
+
+	observeOptions     []metric.ObserveOption
+	idleObserveOptions []metric.ObserveOption
+	usedObserveOptions []metric.ObserveOption
+
+	dbStats     *pgxpool.Stat
+	lastDBStats time.Time
+}
+
+// poolObservation is a metric exported for a registered pool.
+type poolObservation struct {
+	inst    metric.Int64Observable
+	observe statsObserveFunc
+}
+
+// registerPool adds db to the statsRecorder of meter, creating the recorder on
+// first use.
+func registerPool(meter metric.Meter, db PoolStats, o *statsOptions) (*statsRecorder, *registeredPool, error) {
+	statsRecorders.Lock()
+	defer statsRecorders.Unlock()
+
+	// A meter of a type which is not comparable, e.g. a struct with a slice
+	// field, would panic as a map key.
+	shared := reflect.ValueOf(meter).Comparable()
+
+	var r *statsRecorder
+	if shared {
+		r = statsRecorders.m[meter]
+	}
+	if r == nil {
+		r = &statsRecorder{
+			meter:       meter,
+			shared:      shared,
+			instruments: make(map[string]metric.Int64Observable),
+		}
 	}
 
-	if constructingConns, err = meter.Int64ObservableUpDownCounter(
-		pgxPoolConstructingConnections,
-		metric.WithDescription("Number of connections with construction in progress in the pool."),
-	); err != nil {
-		return fmt.Errorf("failed to create asynchronous metric: %s with error: %w", pgxPoolConstructingConnections, err)
+	pool, err := r.add(db, o)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if emptyAcquires, err = meter.Int64ObservableCounter(
-		pgxPoolEmptyAcquire,
-		metric.WithDescription("Cumulative count of successful acquires from the pool that waited for a resource to be released or constructed because the pool was empty."),
-	); err != nil {
-		return fmt.Errorf("failed to create asynchronous metric: %s with error: %w", pgxPoolEmptyAcquire, err)
+	if shared {
+		statsRecorders.m[meter] = r
 	}
+	return r, pool, nil
+}
 
-	if idleConns, err = meter.Int64ObservableUpDownCounter(
-		pgxPoolIdleConnections,
-		metric.WithDescription("Number of currently idle connections in the pool."),
-	); err != nil {
-		return fmt.Errorf("failed to create asynchronous metric: %s with error: %w", pgxPoolIdleConnections, err)
+// add registers db to be observed by the recorder. The pool name is made unique
+// among all pools of the recorder, unless it has been set explicitly.
+// The caller must hold the statsRecorders lock.
+func (r *statsRecorder) add(db PoolStats, o *statsOptions) (*registeredPool, error) {
+	cfg := db.Config()
+
+	derivedName := poolNameFromConfig(cfg)
+	name := o.poolName
+	explicit := name != ""
+	if !explicit {
+		name = derivedName
+	}
+	for _, attr := range o.defaultAttributes {
+		if attr.Key == semconv.DBClientConnectionPoolNameKey {
+			name, explicit = attr.Value.AsString(), true
+		}
 	}
 
-	if maxConns, err = meter.Int64ObservableGauge(
-		pgxPoolMaxConnections,
-		metric.WithDescription("Maximum size of the pool."),
-	); err != nil {
-		return fmt.Errorf("failed to create asynchronous metric: %s with error: %w", pgxPoolMaxConnections, err)
+	if r.hasPoolName(name) {
+		if explicit {
+			return nil, fmt.Errorf("pool name %q is already registered", name)
+		}
+
+		base := name
+		for i := 2; r.hasPoolName(name); i++ {
+			name = fmt.Sprintf("%s#%d", base, i)
+		}
 	}
 
-	if maxIdleDestroyCount, err = meter.Int64ObservableCounter(
-		pgxPoolMaxIdleDestroyCount,
-		metric.WithDescription("Cumulative count of connections destroyed because they exceeded MaxConnectionsIdleTime."),
-	); err != nil {
-		return fmt.Errorf("failed to create asynchronous metric: %s with error: %w", pgxPoolMaxIdleDestroyCount, err)
+	attrs := make([]attribute.KeyValue, 0, len(o.defaultAttributes)+2)
+	attrs = append(attrs, semconv.DBSystemNamePostgreSQL, semconv.DBClientConnectionPoolName(name))
+	attrs = append(attrs, o.defaultAttributes...)
+
+	pool := &registeredPool{
+		db:                         db,
+		name:                       name,
+		minimumReadDBStatsInterval: o.minimumReadDBStatsInterval,
+		minIdleConns:               int64(cfg.MinIdleConns),
+		observeOptions: []metric.ObserveOption{
+			metric.WithAttributeSet(attribute.NewSet(withAttributes(attrs)...)),
+		},
+		idleObserveOptions: []metric.ObserveOption{
+			metric.WithAttributeSet(attribute.NewSet(withAttributes(attrs, semconv.DBClientConnectionStateIdle)...)),
+		},
+		usedObserveOptions: []metric.ObserveOption{
+			metric.WithAttributeSet(attribute.NewSet(withAttributes(attrs, semconv.DBClientConnectionStateUsed)...)),
+		},
 	}
 
-	if maxLifetimeDestroyCount, err = meter.Int64ObservableCounter(
-		pgxPoolMaxLifetimeDestroyCount,
-		metric.WithDescription("Cumulative count of connections destroyed because they exceeded MaxConnectionsLifetime."),
-	); err != nil {
-		return fmt.Errorf("failed to create asynchronous metric: %s with error: %w", pgxPoolMaxLifetimeDestroyCount, err)
+	var created bool
+	for i := range statsMetrics {
+		m := &statsMetrics[i]
+		if !m.enabled(o) {
+			continue
+		}
+
+		inst, ok := r.instruments[o.namePrefix+m.name]
+		if !ok {
+			var err error
+			if inst, err = m.createInstrument(r.meter, o.namePrefix); err != nil {
+				return nil, err
+			}
+			r.instruments[o.namePrefix+m.name] = inst
+			created = true
+		}
+
+		pool.observations = append(pool.observations, poolObservation{inst: inst, observe: m.observe})
 	}
 
-	if newConnsCount, err = meter.Int64ObservableCounter(
-		pgxPoolNewConnectionsCount,
-		metric.WithDescription("Cumulative count of new connections opened."),
-	); err != nil {
-		return fmt.Errorf("failed to create asynchronous metric: %s with error: %w", pgxPoolNewConnectionsCount, err)
+	if created || r.reg == nil {
+		if err := r.registerCallback(); err != nil {
+			return nil, err
+		}
 	}
 
-	if totalConns, err = meter.Int64ObservableUpDownCounter(
-		pgxPoolTotalConnections,
-		metric.WithDescription("Total number of resources currently in the pool. The value is the sum of ConstructingConnections, AcquiredConnections, and IdleConnections."),
-	); err != nil {
-		return fmt.Errorf("failed to create asynchronous metric: %s with error: %w", pgxPoolTotalConnections, err)
+	r.lock.Lock()
+	r.pools = append(r.pools, pool)
+	r.lock.Unlock()
+
+	pool.registration = &poolRegistration{name: name, derivedName: derivedName}
+	registeredPools.Store(db, pool.registration)
+
+	return pool, nil
+}
+
+// registerCallback (re-)registers the callback for all instruments of the
+// recorder. The caller must hold the statsRecorders lock.
+func (r *statsRecorder) registerCallback() error {
+	if r.reg != nil {
+		if err := r.reg.Unregister(); err != nil {
+			return err
+		}
+		r.reg = nil
 	}
 
-	if emptyAcquireWaitTime, err = meter.Int64ObservableCounter(
-		pgxPoolEmptyAcquireWaitTime,
-		metric.WithDescription("Total time waited for successful acquires from the pool for a resource to be released or constructed because the pool was empty."),
-		metric.WithUnit("ns"),
-	); err != nil {
-		return fmt.Errorf("failed to create asynchronous metric: %s with error: %w", pgxPoolEmptyAcquireWaitTime, err)
+	instruments := make([]metric.Observable, 0, len(r.instruments))
+	for _, inst := range r.instruments {
+		instruments = append(instruments, inst)
 	}
 
-	observeOptions = []metric.ObserveOption{
-		metric.WithAttributeSet(attribute.NewSet(attrs...)),
+	reg, err := r.meter.RegisterCallback(r.observe, instruments...)
+	if err != nil {
+		return err
 	}
 
-	_, err = meter.RegisterCallback(
-		func(ctx context.Context, o metric.Observer) error {
-			lock.Lock()
-			defer lock.Unlock()
+	r.reg = reg
+	return nil
+}
 
-			now := time.Now()
-			if now.Sub(lastDBStats) >= minimumReadDBStatsInterval {
-				dbStats = db.Stat()
-				lastDBStats = now
-			}
+// hasPoolName reports whether a pool with the given name is registered.
+func (r *statsRecorder) hasPoolName(name string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
 
-			o.ObserveInt64(acquireCount, dbStats.AcquireCount(), observeOptions...)
-			o.ObserveInt64(acquireDuration, dbStats.AcquireDuration().Nanoseconds(), observeOptions...)
-			o.ObserveInt64(acquiredConns, int64(dbStats.AcquiredConns()), observeOptions...)
-			o.ObserveInt64(cancelledAcquires, dbStats.CanceledAcquireCount(), observeOptions...)
-			o.ObserveInt64(constructingConns, int64(dbStats.ConstructingConns()), observeOptions...)
-			o.ObserveInt64(emptyAcquires, dbStats.EmptyAcquireCount(), observeOptions...)
-			o.ObserveInt64(idleConns, int64(dbStats.IdleConns()), observeOptions...)
-			o.ObserveInt64(maxConns, int64(dbStats.MaxConns()), observeOptions...)
-			o.ObserveInt64(maxIdleDestroyCount, dbStats.MaxIdleDestroyCount(), observeOptions...)
-			o.ObserveInt64(maxLifetimeDestroyCount, dbStats.MaxLifetimeDestroyCount(), observeOptions...)
-			o.ObserveInt64(newConnsCount, dbStats.NewConnsCount(), observeOptions...)
-			o.ObserveInt64(totalConns, int64(dbStats.TotalConns()), observeOptions...)
-			o.ObserveInt64(emptyAcquireWaitTime, dbStats.EmptyAcquireWaitTime().Nanoseconds(), observeOptions...)
-
-			return nil
-		},
-		acquireCount,
-		acquireDuration,
-		acquiredConns,
-		cancelledAcquires,
-		constructingConns,
-		emptyAcquires,
-		idleConns,
-		maxConns,
-		maxIdleDestroyCount,
-		maxLifetimeDestroyCount,
-		newConnsCount,
-		totalConns,
-		emptyAcquireWaitTime,
-	)
+	for _, p := range r.pools {
+		if p.name == name {
+			return true
+		}
+	}
+	return false
+}
 
+// remove stops observing pool. Once no pools are left, the callback is
+// unregistered and the recorder is discarded.
+func (r *statsRecorder) remove(pool *registeredPool) error {
+	statsRecorders.Lock()
+	defer statsRecorders.Unlock()
+
+	r.lock.Lock()
+	for i, p := range r.pools {
+		if p == pool {
+			r.pools = append(r.pools[:i], r.pools[i+1:]...)
+			break
+		}
+	}
+	remaining := len(r.pools)
+	r.lock.Unlock()
+
+	registeredPools.CompareAndDelete(pool.db, pool.registration)
+
+	if remaining > 0 || r.reg == nil {
+		return nil
+	}
+
+	if r.shared {
+		delete(statsRecorders.m, r.meter)
+	}
+	err := r.reg.Unregister()
+	r.reg = nil
 	return err
 }
+
+// observe is the callback observing the statistics of all registered pools.
+func (r *statsRecorder) observe(_ context.Context, obs metric.Observer) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	for _, p := range r.pools {
+		if p.dbStats == nil || now.Sub(p.lastDBStats) >= p.minimumReadDBStatsInterval {
+			p.dbStats = p.db.Stat()
+			p.lastDBStats = now
+		}
+
+		for _, o := range p.observations {
+			o.observe(obs, o.inst, p, p.dbStats)
+		}
+	}
+
+	return nil
+}
@@ -2,10 +2,13 @@ package otelpgx
 
 import (
 	"context"
+	"slices"
 	"testing"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
@@ -14,23 +17,14 @@ import (
 func TestRecordStats_UserAttrsOverrideLibraryDefaults(t *testing.T) {
 	ctx := context.Background()
 
-	cfg, err := pgxpool.ParseConfig("postgres://user@127.0.0.1:5432/somedb")
-	if err != nil {
-		t.Fatalf("pgxpool.ParseConfig: %v", err)
-	}
-
-	pool, err := pgxpool.NewWithConfig(ctx, cfg)
-	if err != nil {
-		t.Fatalf("pgxpool.NewWithConfig: %v", err)
-	}
-	t.Cleanup(pool.Close)
+	pool := newTestPool(t, "postgres://user@127.0.0.1:5432/somedb")
 
 	reader := sdkmetric.NewManualReader()
 	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
 
 	const overridePoolName = "my-logical-pool"
 
-	err = RecordStats(pool,
+	err := RecordStats(pool,
 		WithStatsMeterProvider(provider),
 		WithStatsAttributes(semconv.DBClientConnectionPoolName(overridePoolName)),
 	)
@@ -97,3 +91,253 @@ func dataPointAttributes(data metricdata.Aggregation) []attribute.Set {
 	}
 	return sets
 }
+
+func TestRecordStats_SemconvMetrics(t *testing.T) {
+	ctx := context.Background()
+
+	pool := newTestPool(t, "postgres://user@127.0.0.1:5432/somedb?pool_max_conns=7&pool_min_idle_conns=2")
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	if err := RecordStats(pool, WithStatsMeterProvider(provider), WithStatsSemconvMetrics()); err != nil {
+		t.Fatalf("RecordStats: %v", err)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("reader.Collect: %v", err)
+	}
+
+	values := map[string]int64{}
+	states := map[string]bool{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			if !ok {
+				continue
+			}
+			for _, dp := range sum.DataPoints {
+				if state, ok := dp.Attributes.Value(semconv.DBClientConnectionStateKey); ok {
+					states[state.AsString()] = true
+					continue
+				}
+				values[m.Name] = dp.Value
+			}
+		}
+	}
+
+	if !states["idle"] || !states["used"] {
+		t.Errorf("db.client.connection.count: got states %v, want idle and used", states)
+	}
+	if got := values["db.client.connection.max"]; got != 7 {
+		t.Errorf("db.client.connection.max = %d, want 7", got)
+	}
+	if got := values["db.client.connection.idle.min"]; got != 2 {
+		t.Errorf("db.client.connection.idle.min = %d, want 2", got)
+	}
+	if _, ok := values["db.client.connection.timeouts"]; !ok {
+		t.Error("missing db.client.connection.timeouts metric")
+	}
+	// The legacy metrics must still be exported.
+	if _, ok := values[pgxPoolAcquireCount]; !ok {
+		t.Errorf("missing %s metric", pgxPoolAcquireCount)
+	}
+}
+
+func TestRegisterStats_Unregister(t *testing.T) {
+	ctx := context.Background()
+
+	pool := newTestPool(t, "postgres://user@127.0.0.1:5432/somedb")
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	reg, err := RegisterStats(pool, WithStatsMeterProvider(provider))
+	if err != nil {
+		t.Fatalf("RegisterStats: %v", err)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("reader.Collect: %v", err)
+	}
+	if got := countDataPoints(rm); got == 0 {
+		t.Fatal("expected data points while registered")
+	}
+
+	pool.Close()
+	if err := reg.Unregister(); err != nil {
+		t.Fatalf("Unregister: %v", err)
+	}
+	if err := reg.Unregister(); err != nil {
+		t.Fatalf("second Unregister: %v", err)
+	}
+
+	rm = metricdata.ResourceMetrics{}
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("reader.Collect: %v", err)
+	}
+	if got := countDataPoints(rm); got != 0 {
+		t.Errorf("got %d data points after Unregister, want 0", got)
+	}
+}
+
+// countDataPoints returns the number of data points across all collected metrics.
+func countDataPoints(rm metricdata.ResourceMetrics) int {
+	var n int
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			n += len(dataPointAttributes(m.Data))
+		}
+	}
+	return n
+}
+
+// uncomparableMeterProvider returns meters which cannot be used as map keys.
+type uncomparableMeterProvider struct {
+	noop.MeterProvider
+}
+
+type uncomparableMeter struct {
+	noop.Meter
+	tags []string
+}
+
+func (uncomparableMeterProvider) Meter(string, ...metric.MeterOption) metric.Meter {
+	return uncomparableMeter{}
+}
+
+func TestRegisterStats_UncomparableMeter(t *testing.T) {
+	pool := newTestPool(t, "postgres://user@127.0.0.1:5432/somedb")
+
+	reg, err := RegisterStats(pool, WithStatsMeterProvider(uncomparableMeterProvider{}))
+	if err != nil {
+		t.Fatalf("RegisterStats: %v", err)
+	}
+	if err := reg.Unregister(); err != nil {
+		t.Fatalf("Unregister: %v", err)
+	}
+}
+
+func TestRegisterStats_PoolNames(t *testing.T) {
+	ctx := context.Background()
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	const dsn = "postgres://user@127.0.0.1:5432/somedb"
+	oltp, reporting, named := newTestPool(t, dsn), newTestPool(t, dsn), newTestPool(t, dsn)
+
+	for _, tc := range []struct {
+		pool *pgxpool.Pool
+		opts []StatsOption
+	}{
+		{pool: oltp},
+		{pool: reporting},
+		{pool: named, opts: []StatsOption{WithStatsPoolName("analytics")}},
+	} {
+		reg, err := RegisterStats(tc.pool, append([]StatsOption{WithStatsMeterProvider(provider)}, tc.opts...)...)
+		if err != nil {
+			t.Fatalf("RegisterStats: %v", err)
+		}
+		t.Cleanup(func() {
+			if err := reg.Unregister(); err != nil {
+				t.Errorf("Unregister: %v", err)
+			}
+		})
+	}
+
+	if _, err := RegisterStats(newTestPool(t, dsn), WithStatsMeterProvider(provider), WithStatsPoolName("analytics")); err == nil {
+		t.Error("expected an error registering a duplicate explicit pool name")
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("reader.Collect: %v", err)
+	}
+
+	names := map[string]bool{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != pgxPoolMaxConnections {
+				continue
+			}
+			for _, attrs := range dataPointAttributes(m.Data) {
+				v, _ := attrs.Value(semconv.DBClientConnectionPoolNameKey)
+				names[v.AsString()] = true
+			}
+		}
+	}
+
+	for _, want := range []string{"127.0.0.1:5432/somedb", "127.0.0.1:5432/somedb#2", "analytics"} {
+		if !names[want] {
+			t.Errorf("missing pool name %q, got %v", want, names)
+		}
+	}
+
+	reg, ok := registeredPools.Load(reporting)
+	if !ok {
+		t.Fatal("reporting pool is not registered")
+	}
+	if got := reg.(*poolRegistration).name; got != "127.0.0.1:5432/somedb#2" {
+		t.Errorf("registered name of reporting = %q, want %q", got, "127.0.0.1:5432/somedb#2")
+	}
+}
+
+func TestRegisterStats_SelectMetrics(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		opts []StatsOption
+		want []string
+	}{
+		{
+			name: "semconv connections only",
+			opts: []StatsOption{
+				WithStatsNaming(StatsNamingSemconv),
+				WithStatsGroups(StatsGroupConnections),
+				WithStatsDisabledMetrics("db.client.connection.idle.min"),
+			},
+			want: []string{"db.client.connection.count", "db.client.connection.max"},
+		},
+		{
+			name: "prefixed legacy destroys",
+			opts: []StatsOption{
+				WithStatsGroups(StatsGroupDestroys),
+				WithStatsNamePrefix("myapp."),
+			},
+			want: []string{"myapp.pgxpool.max_idle_destroys", "myapp.pgxpool.max_lifetime_destroys"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := newTestPool(t, "postgres://user@127.0.0.1:5432/somedb")
+
+			reader := sdkmetric.NewManualReader()
+			provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+			if err := RecordStats(pool, append([]StatsOption{WithStatsMeterProvider(provider)}, tt.opts...)...); err != nil {
+				t.Fatalf("RecordStats: %v", err)
+			}
+
+			var rm metricdata.ResourceMetrics
+			if err := reader.Collect(ctx, &rm); err != nil {
+				t.Fatalf("reader.Collect: %v", err)
+			}
+
+			var got []string
+			for _, sm := range rm.ScopeMetrics {
+				for _, m := range sm.Metrics {
+					got = append(got, m.Name)
+				}
+			}
+
+			if !slices.Equal(slices.Sorted(slices.Values(got)), tt.want) {
+				t.Errorf("exported metrics = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
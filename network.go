@@ -0,0 +1,175 @@
+package otelpgx
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// NetworkBytesSentKey represents the number of bytes sent to the server
+	// during an operation.
+	NetworkBytesSentKey = attribute.Key("pgx.network.bytes_sent")
+	// NetworkBytesReceivedKey represents the number of bytes received from the
+	// server during an operation.
+	NetworkBytesReceivedKey = attribute.Key("pgx.network.bytes_received")
+	// DBClientNetworkIOKey represents the count of bytes sent and received
+	// over database connections
+	DBClientNetworkIOKey = attribute.Key("db.client.network.io")
+)
+
+// countingConnDataKey is the key of the countingConn in the custom data of a
+// connection.
+const countingConnDataKey = "otelpgx.counting_conn"
+
+// InstrumentDialFunc wraps the DialFunc of config to count the bytes sent and
+// received over each connection. The counts are recorded per pool in the
+// db.client.network.io metric, see WithPoolName for the pool name, and the
+// bytes of each query, batch and CopyFrom are added to its span. The bytes are
+// counted below TLS, i.e. as transferred over the network.
+func (t *Tracer) InstrumentDialFunc(config *pgconn.Config) {
+	t.networkIOEnabled.Store(true)
+
+	dialFunc := config.DialFunc
+	if dialFunc == nil {
+		dialFunc = (&net.Dialer{}).DialContext
+	}
+
+	config.DialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialFunc(ctx, network, addr)
+		if err != nil {
+			return conn, err
+		}
+
+		var poolName string
+		if op := operationFromContext(ctx, pgxOperationConnect); op != nil && op.connect != nil {
+			poolName = op.connect.poolName
+		} else {
+			poolName = t.connectPoolName(config)
+		}
+
+		return &countingConn{
+			Conn:          conn,
+			counter:       t.networkIO,
+			transmitAttrs: t.networkIOAttributeSet(poolName, semconv.NetworkIODirectionTransmit),
+			receiveAttrs:  t.networkIOAttributeSet(poolName, semconv.NetworkIODirectionReceive),
+		}, nil
+	}
+}
+
+// networkIOAttributeSet returns the cached attribute set of the network I/O
+// count of a pool in the given direction.
+func (t *Tracer) networkIOAttributeSet(poolName string, direction attribute.KeyValue) attribute.Set {
+	key := poolName + "/" + direction.Value.AsString()
+	if set, ok := t.networkIOAttrs.Load(key); ok {
+		return set.(attribute.Set)
+	}
+
+	set := attribute.NewSet(withAttributes(t.meterAttrs,
+		semconv.DBClientConnectionPoolName(poolName),
+		direction,
+	)...)
+	t.networkIOAttrs.Store(key, set)
+	return set
+}
+
+// countingConn is a net.Conn which counts the bytes sent and received.
+type countingConn struct {
+	net.Conn
+
+	counter       metric.Int64Counter
+	transmitAttrs attribute.Set
+	receiveAttrs  attribute.Set
+
+	sent     atomic.Int64
+	received atomic.Int64
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.received.Add(int64(n))
+		c.counter.Add(context.Background(), int64(n), metric.WithAttributeSet(c.receiveAttrs))
+	}
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.sent.Add(int64(n))
+		c.counter.Add(context.Background(), int64(n), metric.WithAttributeSet(c.transmitAttrs))
+	}
+	return n, err
+}
+
+// NetConn returns the underlying connection.
+func (c *countingConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// findCountingConn returns the countingConn underlying the network connection
+// of conn, if its DialFunc has been instrumented. The result is cached with
+// the connection.
+func findCountingConn(conn *pgx.Conn) *countingConn {
+	pgConn := conn.PgConn()
+	if pgConn == nil {
+		return nil
+	}
+
+	data := pgConn.CustomData()
+	if cc, ok := data[countingConnDataKey].(*countingConn); ok {
+		return cc
+	}
+
+	netConn := pgConn.Conn()
+	for netConn != nil {
+		switch c := netConn.(type) {
+		case *countingConn:
+			if data != nil {
+				data[countingConnDataKey] = c
+			}
+			return c
+		case *tls.Conn:
+			netConn = c.NetConn()
+		case interface{ NetConn() net.Conn }:
+			netConn = c.NetConn()
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// startNetworkIO stores the byte counts of the connection of op at its start,
+// so that endNetworkIO can compute the bytes transferred by the operation.
+func (t *Tracer) startNetworkIO(op *operation, conn *pgx.Conn) {
+	if conn == nil || !t.networkIOEnabled.Load() {
+		return
+	}
+
+	if op.netConn = findCountingConn(conn); op.netConn != nil {
+		op.bytesSent = op.netConn.sent.Load()
+		op.bytesReceived = op.netConn.received.Load()
+	}
+}
+
+// endNetworkIO adds the bytes transferred by op to span.
+func (t *Tracer) endNetworkIO(op *operation, span trace.Span) {
+	if op == nil || op.netConn == nil {
+		return
+	}
+
+	span.SetAttributes(
+		NetworkBytesSentKey.Int64(op.netConn.sent.Load()-op.bytesSent),
+		NetworkBytesReceivedKey.Int64(op.netConn.received.Load()-op.bytesReceived),
+	)
+}
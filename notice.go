@@ -0,0 +1,95 @@
+package otelpgx
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// noticeEventName is the name of span events recorded for notices.
+const noticeEventName = "pgx.notice"
+
+// InstrumentNotices installs an OnNotice handler into config which records
+// notices and warnings sent by the server, e.g. by RAISE NOTICE in PL/pgSQL, as
+// events on the span of the query, batch or CopyFrom in progress on the
+// connection. Warnings are additionally counted by their SQLSTATE code in the
+// db.client.response.warnings metric. Any existing OnNotice handler is still
+// called.
+//
+// The detail of notices is subject to the PgErrorRedactFunc configured with
+// WithPgErrorRedactFunc.
+func (t *Tracer) InstrumentNotices(config *pgconn.Config) {
+	t.noticesEnabled.Store(true)
+
+	onNotice := config.OnNotice
+	config.OnNotice = func(pgConn *pgconn.PgConn, notice *pgconn.Notice) {
+		t.recordNotice(pgConn, notice)
+
+		if onNotice != nil {
+			onNotice(pgConn, notice)
+		}
+	}
+}
+
+// recordNotice records notice as an event on the active span of pgConn and
+// counts it if it is a warning.
+func (t *Tracer) recordNotice(pgConn *pgconn.PgConn, notice *pgconn.Notice) {
+	severity := notice.SeverityUnlocalized
+	if severity == "" {
+		severity = notice.Severity
+	}
+
+	if severity == "WARNING" {
+		t.noticeWarnings.Add(context.Background(), 1, metric.WithAttributeSet(t.noticeWarningAttributeSet(notice.Code)))
+	}
+
+	span, ok := t.activeSpans.Load(pgConn)
+	if !ok {
+		return
+	}
+
+	attrs := []attribute.KeyValue{
+		PgErrorSeverityKey.String(severity),
+		SQLStateKey.String(notice.Code),
+		PgErrorMessageKey.String(notice.Message),
+	}
+	if detail := t.redactPgErrorField(PgErrorDetailKey, notice.Detail); detail != "" {
+		attrs = append(attrs, PgErrorDetailKey.String(detail))
+	}
+
+	span.(trace.Span).AddEvent(noticeEventName, trace.WithAttributes(attrs...))
+}
+
+// noticeWarningAttributeSet returns the cached attribute set of the warning
+// count for the given SQLSTATE code.
+func (t *Tracer) noticeWarningAttributeSet(code string) attribute.Set {
+	if set, ok := t.noticeWarningSet.Load(code); ok {
+		return set.(attribute.Set)
+	}
+
+	set := attribute.NewSet(withAttributes(t.meterAttrs, semconv.DBResponseStatusCode(code))...)
+	t.noticeWarningSet.Store(code, set)
+	return set
+}
+
+// setActiveSpan records the span of op as the span of the operation in progress
+// on conn, if it is recording, notices are instrumented and events are enabled
+// for op.
+func (t *Tracer) setActiveSpan(conn *pgx.Conn, op *operation) {
+	if conn != nil && op.span != nil && op.span.IsRecording() && t.noticesEnabled.Load() && t.enabled(op.pgxOperation, InstrumentationEvents) {
+		t.activeSpans.Store(conn.PgConn(), op.span)
+	}
+}
+
+// clearActiveSpan removes span as the span of the operation in progress on
+// conn, if it still is.
+func (t *Tracer) clearActiveSpan(conn *pgx.Conn, span trace.Span) {
+	if conn != nil && t.noticesEnabled.Load() {
+		t.activeSpans.CompareAndDelete(conn.PgConn(), span)
+	}
+}
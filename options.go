@@ -2,8 +2,11 @@ package otelpgx
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
@@ -73,12 +76,283 @@ func WithTrimSQLInSpanName() Option {
 
 // WithDisableAcquireTracer disables tracing for connection acquire events from
 // the connection pool. By default, acquire tracing is enabled.
+//
+// Deprecated: Use WithInstrumentation(OperationAcquire, InstrumentationNone)
+// instead.
 func WithDisableAcquireTracer() Option {
+	return WithInstrumentation(OperationAcquire, InstrumentationNone)
+}
+
+// Operation is a type of operation traced by the Tracer, as recorded in the
+// pgx.operation.type attribute.
+type Operation string
+
+const (
+	// OperationQuery are Query, QueryRow and Exec calls.
+	OperationQuery Operation = pgxOperationQuery
+	// OperationBatch are SendBatch calls and the queries of the batch.
+	OperationBatch Operation = pgxOperationBatch
+	// OperationCopy are CopyFrom calls.
+	OperationCopy Operation = pgxOperationCopy
+	// OperationConnect are new connections, including their lookup, dial, TLS
+	// and authentication phases.
+	OperationConnect Operation = pgxOperationConnect
+	// OperationPrepare are Prepare calls.
+	OperationPrepare Operation = pgxOperationPrepare
+	// OperationAcquire are acquires of connections from a pool, and the time
+	// connections are held until they are released.
+	OperationAcquire Operation = pgxOperationAcquire
+)
+
+// Instrumentation selects the telemetry recorded for a type of operation. The
+// values can be combined.
+type Instrumentation int
+
+const (
+	// InstrumentationSpans records spans.
+	InstrumentationSpans Instrumentation = 1 << iota
+	// InstrumentationMetrics records metrics. They are recorded regardless of
+	// whether the operation is part of a recorded trace.
+	InstrumentationMetrics
+	// InstrumentationEvents records events on the spans, i.e. errors, notices
+	// and the progress of the operation. Events are only recorded along with
+	// spans.
+	InstrumentationEvents
+)
+
+const (
+	// InstrumentationNone disables the instrumentation of an operation.
+	InstrumentationNone Instrumentation = 0
+	// InstrumentationAll records spans, metrics and events. This is the
+	// default for all operations.
+	InstrumentationAll = InstrumentationSpans | InstrumentationMetrics | InstrumentationEvents
+)
+
+// WithInstrumentation selects the telemetry recorded for operations of type op,
+// e.g. to record metrics of connect operations without spans:
+//
+//	WithInstrumentation(OperationConnect, InstrumentationMetrics)
+//
+// By default, InstrumentationAll is recorded for all operations.
+func WithInstrumentation(op Operation, instrumentation Instrumentation) Option {
+	return optionFunc(func(cfg *tracerConfig) {
+		if cfg.instrumentation == nil {
+			cfg.instrumentation = make(map[string]Instrumentation)
+		}
+		cfg.instrumentation[string(op)] = instrumentation
+	})
+}
+
+// RootSpanFilter decides whether a root span is recorded for an operation of
+// type op which took elapsed and failed with err, if not nil.
+type RootSpanFilter func(op Operation, elapsed time.Duration, err error) bool
+
+// WithRootSpans starts root spans for operations outside of any trace, e.g. of
+// background jobs, migrations or goroutines without a parent span. By default,
+// spans are only started within a recording span. Operations within a trace
+// which has not been sampled remain without spans, and connection acquires
+// never start root spans.
+//
+// If filter is not nil, it is called at the end of each operation to decide
+// whether its span is recorded, e.g. with RootSpansSlowerThan or
+// RootSpansOnError. The span is then started retroactively, so it has no child
+// spans and no events recorded while the operation was in progress.
+func WithRootSpans(filter RootSpanFilter) Option {
 	return optionFunc(func(cfg *tracerConfig) {
-		cfg.disableAcquireTracer = true
+		cfg.rootSpans = true
+		cfg.rootSpanFilter = filter
 	})
 }
 
+// RootSpansSlowerThan returns a RootSpanFilter which records the root spans of
+// operations which took at least threshold.
+func RootSpansSlowerThan(threshold time.Duration) RootSpanFilter {
+	return func(_ Operation, elapsed time.Duration, _ error) bool {
+		return elapsed >= threshold
+	}
+}
+
+// RootSpansOnError returns a RootSpanFilter which records the root spans of
+// failed operations. sql.ErrNoRows is not considered a failure.
+func RootSpansOnError() RootSpanFilter {
+	return func(_ Operation, _ time.Duration, err error) bool {
+		return err != nil && !errors.Is(err, sql.ErrNoRows)
+	}
+}
+
+// MetricAttribute selects optional attributes recorded on the
+// db.client.operation.duration metric. The values can be combined.
+type MetricAttribute int
+
+const (
+	// MetricAttributeOperationName records db.operation.name, as returned by
+	// the span name function. Custom span name functions must return low
+	// cardinality values when this is enabled.
+	MetricAttributeOperationName MetricAttribute = 1 << iota
+	// MetricAttributeCollectionName records db.collection.name. It is only
+	// available for CopyFrom, as the tracer does not parse SQL statements.
+	MetricAttributeCollectionName
+	// MetricAttributeNamespace records db.namespace.
+	MetricAttributeNamespace
+	// MetricAttributeServerAddress records server.address.
+	MetricAttributeServerAddress
+	// MetricAttributeServerPort records server.port.
+	MetricAttributeServerPort
+	// MetricAttributeErrorType records error.type for failed operations.
+	MetricAttributeErrorType
+	// MetricAttributeResponseStatusCode records db.response.status_code, the
+	// SQLSTATE of failed operations.
+	MetricAttributeResponseStatusCode
+)
+
+// defaultMetricAttributes are the optional metric attributes recorded by default.
+const defaultMetricAttributes = MetricAttributeNamespace | MetricAttributeServerAddress | MetricAttributeServerPort |
+	MetricAttributeErrorType | MetricAttributeResponseStatusCode
+
+// WithMetricAttributes enables recording the given optional attributes on the
+// db.client.operation.duration metric. By default, db.namespace, server.address,
+// server.port, error.type and db.response.status_code are recorded.
+func WithMetricAttributes(attrs MetricAttribute) Option {
+	return optionFunc(func(cfg *tracerConfig) {
+		cfg.metricAttributes |= attrs
+	})
+}
+
+// WithoutMetricAttributes disables recording the given optional attributes on
+// the db.client.operation.duration metric.
+func WithoutMetricAttributes(attrs MetricAttribute) Option {
+	return optionFunc(func(cfg *tracerConfig) {
+		cfg.metricAttributes &^= attrs
+	})
+}
+
+// WithHistogramBuckets sets explicit bucket boundaries for the histogram metric
+// with the given name, e.g. "db.client.operation.duration". This takes
+// precedence over WithDurationHistogramBuckets.
+func WithHistogramBuckets(metricName string, bounds ...float64) Option {
+	return optionFunc(func(cfg *tracerConfig) {
+		if cfg.histogramBuckets == nil {
+			cfg.histogramBuckets = make(map[string][]float64)
+		}
+		cfg.histogramBuckets[metricName] = bounds
+	})
+}
+
+// WithDurationHistogramBuckets sets explicit bucket boundaries in seconds for
+// all duration histograms created by the tracer, i.e.
+// db.client.operation.duration and the db.client.connection.* timings.
+func WithDurationHistogramBuckets(bounds ...float64) Option {
+	return optionFunc(func(cfg *tracerConfig) {
+		cfg.durationHistogramBuckets = bounds
+	})
+}
+
+// ErrorTypeFunc is a function that can be used to classify errors returned by
+// operations. It returns the value of the error.type attribute for err, or an
+// empty string to fall back to the default classification.
+type ErrorTypeFunc func(err error) string
+
+// WithErrorTypeFunc will use the provided function to classify errors, e.g. to
+// give custom application errors a meaningful error.type. The function is
+// called for every failed operation, so its results should be of low
+// cardinality.
+//
+// By default, errors are classified by their SQLSTATE code, context error or
+// well-known network and pgx error types.
+func WithErrorTypeFunc(fn ErrorTypeFunc) Option {
+	return optionFunc(func(cfg *tracerConfig) {
+		cfg.errorTypeFunc = fn
+	})
+}
+
+// ErrorHandling determines how an error returned by an operation is recorded.
+// The values can be combined.
+type ErrorHandling int
+
+const (
+	// ErrorHandlingSetStatus sets the status of the span to codes.Error, along
+	// with the error.type and db.response.status_code span attributes.
+	ErrorHandlingSetStatus ErrorHandling = 1 << iota
+	// ErrorHandlingCount counts the error in the db.client.operation.errors
+	// metric and records error.type on the operation metrics.
+	ErrorHandlingCount
+	// ErrorHandlingRecordEvent records the error as an exception event on the
+	// span, along with the error attributes.
+	ErrorHandlingRecordEvent
+)
+
+const (
+	// ErrorHandlingIgnore does not record the error at all.
+	ErrorHandlingIgnore ErrorHandling = 0
+	// ErrorHandlingEventOnly records the error on the span only, without
+	// marking the operation as failed.
+	ErrorHandlingEventOnly = ErrorHandlingRecordEvent
+	// ErrorHandlingError records the error as a failure of the operation. This
+	// is the default for all errors except sql.ErrNoRows.
+	ErrorHandlingError = ErrorHandlingSetStatus | ErrorHandlingCount | ErrorHandlingRecordEvent
+)
+
+// ErrorClassifier is a function that can be used to decide how an error
+// returned by an operation is recorded. It returns false if it does not
+// classify err, deferring to the next classifier or the default handling.
+type ErrorClassifier func(err error) (ErrorHandling, bool)
+
+// WithErrorClassifier will use the provided classifiers to decide how errors
+// are recorded, e.g. to not fail spans for expected errors. The classifiers are
+// called in order, and the first one that classifies an error decides.
+//
+// By default, sql.ErrNoRows is ignored and all other errors are handled as
+// ErrorHandlingError.
+func WithErrorClassifier(classifiers ...ErrorClassifier) Option {
+	return optionFunc(func(cfg *tracerConfig) {
+		cfg.errorClassifiers = append(cfg.errorClassifiers, classifiers...)
+	})
+}
+
+// ExpectedSQLStates returns an ErrorClassifier which handles PostgreSQL errors
+// with the given SQLSTATE codes, e.g. "23505" for unique violations on upserts
+// or "40001" for retried serialization failures, as ErrorHandlingEventOnly.
+func ExpectedSQLStates(codes ...string) ErrorClassifier {
+	expected := make(map[string]struct{}, len(codes))
+	for _, code := range codes {
+		expected[code] = struct{}{}
+	}
+
+	return func(err error) (ErrorHandling, bool) {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			if _, ok := expected[pgErr.Code]; ok {
+				return ErrorHandlingEventOnly, true
+			}
+		}
+		return ErrorHandlingIgnore, false
+	}
+}
+
+// ExpectedContextCanceled returns an ErrorClassifier which handles errors
+// caused by a canceled context as ErrorHandlingEventOnly. Exceeded deadlines
+// are not considered expected.
+func ExpectedContextCanceled() ErrorClassifier {
+	return func(err error) (ErrorHandling, bool) {
+		if errors.Is(err, context.Canceled) {
+			return ErrorHandlingEventOnly, true
+		}
+		return ErrorHandlingIgnore, false
+	}
+}
+
+// ExpectedCancellations returns an ErrorClassifier which handles operations
+// canceled by the client or the server, or timed out, as ErrorHandlingEventOnly.
+// They are still counted in the db.client.operation.cancellations metric.
+func ExpectedCancellations() ErrorClassifier {
+	return func(err error) (ErrorHandling, bool) {
+		if cancelReason(err) != "" {
+			return ErrorHandlingEventOnly, true
+		}
+		return ErrorHandlingIgnore, false
+	}
+}
+
 // SpanNameFunc is a function that can be used to generate a span name for a
 // SQL. The function will be called with the SQL statement as a parameter.
 type SpanNameFunc func(stmt string) string
@@ -134,6 +408,50 @@ func WithDisableSQLStatementInAttributes() Option {
 	})
 }
 
+// WithServerIdentityAttributes includes attributes identifying the server and
+// backend process of a connection in its spans: the server version, application
+// name, time zone and encoding reported by the server, and the backend PID
+// which can be looked up in pg_stat_activity and the server log.
+func WithServerIdentityAttributes() Option {
+	return optionFunc(func(cfg *tracerConfig) {
+		cfg.serverIdentity = true
+	})
+}
+
+// WithTimeToFirstRow records when the first row and the complete result of a
+// query are received from the server, as span events and in the
+// db.client.response.time_to_first_row and db.client.response.server_time
+// histograms. pgx ends query spans only once the rows are closed, so this tells
+// the time spent by the database apart from the time the application spent
+// iterating the rows. It requires the connections to be established with the
+// Tracer, and inspects every message received from the server.
+//
+// Messages are observed as pgx reads them, which happens while the application
+// iterates the rows. For results larger than the read buffer of the
+// connection, the complete result is therefore only received once the
+// application has iterated most of the rows, and the server time includes
+// the iteration time.
+func WithTimeToFirstRow() Option {
+	return optionFunc(func(cfg *tracerConfig) {
+		cfg.timeToFirstRow = true
+	})
+}
+
+// WithPoolName sets the db.client.connection.pool.name of the metrics recorded
+// by the Tracer, for a Tracer dedicated to a single pool. Use the same name as
+// passed to WithStatsPoolName, so that the series of both match.
+//
+// By default, the Tracer uses the name a pool has been registered with via
+// RegisterStats. Metrics of connections being established and their network
+// I/O cannot be attributed to a pool, so they use the registered name only if
+// a single registered pool has the same server.address:server.port/db.namespace,
+// and that derived name otherwise.
+func WithPoolName(name string) Option {
+	return optionFunc(func(cfg *tracerConfig) {
+		cfg.poolName = name
+	})
+}
+
 // WithIncludeQueryParameters includes the SQL query parameters in the span attribute with key pgx.query.parameters.
 // This is implicitly disabled if WithDisableSQLStatementInAttributes is used.
 func WithIncludeQueryParameters() Option {
@@ -142,6 +460,31 @@ func WithIncludeQueryParameters() Option {
 	})
 }
 
+// WithPgErrorDetails includes the fields of PostgreSQL errors, such as the
+// detail, hint and constraint name, in span attributes. The detail can contain
+// row values, so consider redacting it with WithPgErrorRedactFunc.
+func WithPgErrorDetails() Option {
+	return optionFunc(func(cfg *tracerConfig) {
+		cfg.pgErrorDetails = true
+	})
+}
+
+// PgErrorRedactFunc is a function that can be used to redact the fields of
+// PostgreSQL errors included by WithPgErrorDetails. The function will be called
+// with the attribute key and the value of every non-empty text field, and
+// returns the value to record. An empty value omits the attribute.
+type PgErrorRedactFunc func(key attribute.Key, value string) string
+
+// WithPgErrorRedactFunc will use the provided function to redact the fields of
+// PostgreSQL errors before they are added to spans. It applies to the error
+// fields included by WithPgErrorDetails and the detail of notices recorded by
+// Tracer.InstrumentNotices.
+func WithPgErrorRedactFunc(fn PgErrorRedactFunc) Option {
+	return optionFunc(func(cfg *tracerConfig) {
+		cfg.pgErrorRedactFunc = fn
+	})
+}
+
 // StatsOption allows for managing RecordStats configuration using functional options.
 type StatsOption interface {
 	applyStatsOptions(o *statsOptions)
@@ -156,6 +499,22 @@ type statsOptions struct {
 
 	// defaultAttributes will be set to each metrics as default.
 	defaultAttributes []attribute.KeyValue
+
+	// poolName sets the db.client.connection.pool.name. If empty, the name is
+	// derived from the connection config.
+	poolName string
+
+	// naming selects the metric names used to export the pool statistics.
+	naming StatsNaming
+
+	// groups selects the groups of pool statistics to export.
+	groups StatsGroup
+
+	// disabledMetrics holds the names of individual metrics not to export.
+	disabledMetrics map[string]struct{}
+
+	// namePrefix is prepended to the name of every exported metric.
+	namePrefix string
 }
 
 type statsOptionFunc func(o *statsOptions)
@@ -178,9 +537,108 @@ func WithStatsAttributes(attrs ...attribute.KeyValue) StatsOption {
 	})
 }
 
+// WithStatsPoolName sets the db.client.connection.pool.name attribute of the pool
+// statistics. By default, the name is derived from the connection config as
+// server.address:server.port/db.namespace. Explicit names must be unique among
+// all pools registered with the same meter provider.
+func WithStatsPoolName(name string) StatsOption {
+	return statsOptionFunc(func(o *statsOptions) {
+		o.poolName = name
+	})
+}
+
 // WithMinimumReadDBStatsInterval sets the minimum interval between calls to db.Stats(). Negative values are ignored.
 func WithMinimumReadDBStatsInterval(interval time.Duration) StatsOption {
 	return statsOptionFunc(func(o *statsOptions) {
 		o.minimumReadDBStatsInterval = interval
 	})
 }
+
+// StatsNaming selects the metric names used by RecordStats. The values can be
+// combined to export the pool statistics under several names, e.g. while
+// migrating dashboards.
+type StatsNaming int
+
+const (
+	// StatsNamingLegacy exports the pool statistics using the pgxpool.* names.
+	StatsNamingLegacy StatsNaming = 1 << iota
+	// StatsNamingSemconv exports the pool statistics following the
+	// OpenTelemetry database semantic conventions: db.client.connection.count
+	// (with db.client.connection.state set to idle or used),
+	// db.client.connection.max, db.client.connection.idle.min and
+	// db.client.connection.timeouts.
+	//
+	// The db.client.connection.pending_requests, db.client.connection.wait_time
+	// and db.client.connection.create_time metrics cannot be derived from the
+	// pool statistics and are recorded by the [Tracer] instead.
+	StatsNamingSemconv
+)
+
+// StatsGroup selects groups of pool statistics exported by RecordStats. The
+// values can be combined.
+type StatsGroup int
+
+const (
+	// StatsGroupConnections contains the number of connections per state and
+	// the pool limits.
+	StatsGroupConnections StatsGroup = 1 << iota
+	// StatsGroupCounts contains the cumulative counts of acquires and new
+	// connections.
+	StatsGroupCounts
+	// StatsGroupDurations contains the cumulative acquire durations.
+	StatsGroupDurations
+	// StatsGroupDestroys contains the cumulative counts of connections
+	// destroyed because of their idle time or lifetime.
+	StatsGroupDestroys
+
+	// StatsGroupAll contains all pool statistics.
+	StatsGroupAll = StatsGroupConnections | StatsGroupCounts | StatsGroupDurations | StatsGroupDestroys
+)
+
+// WithStatsNaming selects the metric names used to export the pool statistics.
+// By default, StatsNamingLegacy is used.
+func WithStatsNaming(naming StatsNaming) StatsOption {
+	return statsOptionFunc(func(o *statsOptions) {
+		o.naming = naming
+	})
+}
+
+// WithStatsSemconvMetrics additionally exports the pool statistics following the
+// OpenTelemetry database semantic conventions. This is equivalent to
+// WithStatsNaming(StatsNamingLegacy | StatsNamingSemconv) unless the naming has
+// been changed by another option.
+func WithStatsSemconvMetrics() StatsOption {
+	return statsOptionFunc(func(o *statsOptions) {
+		o.naming |= StatsNamingSemconv
+	})
+}
+
+// WithStatsGroups restricts the exported pool statistics to the given groups.
+// By default, StatsGroupAll is exported.
+func WithStatsGroups(groups StatsGroup) StatsOption {
+	return statsOptionFunc(func(o *statsOptions) {
+		o.groups = groups
+	})
+}
+
+// WithStatsDisabledMetrics disables exporting individual pool statistics by
+// metric name, without any prefix set by WithStatsNamePrefix, e.g.
+// "pgxpool.empty_acquire" or "db.client.connection.idle.min".
+func WithStatsDisabledMetrics(names ...string) StatsOption {
+	return statsOptionFunc(func(o *statsOptions) {
+		if o.disabledMetrics == nil {
+			o.disabledMetrics = make(map[string]struct{}, len(names))
+		}
+		for _, name := range names {
+			o.disabledMetrics[name] = struct{}{}
+		}
+	})
+}
+
+// WithStatsNamePrefix prepends prefix to the name of every exported pool
+// statistic, e.g. "myapp." results in "myapp.pgxpool.acquires".
+func WithStatsNamePrefix(prefix string) StatsOption {
+	return statsOptionFunc(func(o *statsOptions) {
+		o.namePrefix = prefix
+	})
+}
@@ -0,0 +1,32 @@
+// Package otelpgxsdk provides helpers to configure the OpenTelemetry SDK for
+// the instrumentation of the otelpgx package. It is separate so that otelpgx
+// itself only depends on the OpenTelemetry API.
+package otelpgxsdk
+
+import (
+	"github.com/exaring/otelpgx"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// ExponentialHistogramView returns a view which aggregates all histograms
+// recorded by otelpgx as base-2 exponential histograms with the given maximum
+// number of buckets and maximum scale. Pass it to the meter provider with
+// sdkmetric.WithView.
+//
+// Exponential histograms cannot be requested through the metrics API, so this
+// requires configuring the SDK, but not matching individual instrument names.
+func ExponentialHistogramView(maxSize, maxScale int32) sdkmetric.View {
+	return sdkmetric.NewView(
+		sdkmetric.Instrument{
+			Kind:  sdkmetric.InstrumentKindHistogram,
+			Scope: instrumentation.Scope{Name: otelpgx.ScopeName},
+		},
+		sdkmetric.Stream{
+			Aggregation: sdkmetric.AggregationBase2ExponentialHistogram{
+				MaxSize:  maxSize,
+				MaxScale: maxScale,
+			},
+		},
+	)
+}
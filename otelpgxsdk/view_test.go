@@ -0,0 +1,40 @@
+package otelpgxsdk
+
+import (
+	"context"
+	"testing"
+
+	"github.com/exaring/otelpgx"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestExponentialHistogramView(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(reader),
+		sdkmetric.WithView(ExponentialHistogramView(160, 20)),
+	)
+
+	tracer := otelpgx.NewTracer(otelpgx.WithMeterProvider(mp))
+
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "db.client.operation.duration" {
+				continue
+			}
+			_, ok := m.Data.(metricdata.ExponentialHistogram[float64])
+			require.Truef(t, ok, "got aggregation %T, want exponential histogram", m.Data)
+			return
+		}
+	}
+	t.Fatal("missing db.client.operation.duration metric")
+}
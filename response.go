@@ -0,0 +1,85 @@
+package otelpgx
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// DBClientResponseTimeToFirstRowKey represents the duration from the start
+	// of a query until its first row is received from the server
+	DBClientResponseTimeToFirstRowKey = attribute.Key("db.client.response.time_to_first_row")
+	// DBClientResponseServerTimeKey represents the duration from the start of
+	// a query until the server has sent its complete result
+	DBClientResponseServerTimeKey = attribute.Key("db.client.response.server_time")
+)
+
+// handleResponse records the arrival of a backend message of the given type
+// while the query op is in progress.
+func (op *operation) handleResponse(msgType byte) {
+	switch msgType {
+	case 'D': // DataRow
+		if op.firstRowAt.IsZero() {
+			op.firstRowAt = time.Now()
+		}
+	case 'Z': // ReadyForQuery, which follows the results of all statements
+		if op.completedAt.IsZero() {
+			op.completedAt = time.Now()
+		}
+	}
+}
+
+// startResponseTiming registers the query op with the sniffingReader of conn,
+// so that the arrival of its rows and the completion of its result are
+// recorded.
+func (t *Tracer) startResponseTiming(op *operation, conn *pgx.Conn) {
+	if !t.timeToFirstRow || conn == nil || conn.PgConn() == nil {
+		return
+	}
+
+	sc, ok := conn.PgConn().CustomData()[snifferDataKey].(*sniffingReader)
+	if !ok || !sc.trackResponses {
+		return
+	}
+
+	op.startedAt = time.Now()
+	op.sniffer = sc
+	sc.active.Store(op)
+}
+
+// endResponseTiming records the time to the first row and the server time of
+// the query op, separately from the time the application spent iterating the
+// rows.
+func (t *Tracer) endResponseTiming(ctx context.Context, op *operation, span trace.Span) {
+	if op == nil || op.sniffer == nil {
+		return
+	}
+	op.sniffer.active.CompareAndSwap(op, nil)
+
+	attrs := metric.WithAttributeSet(t.operationAttributeSet(op.key))
+	metrics := t.enabled(pgxOperationQuery, InstrumentationMetrics)
+	events := t.enabled(pgxOperationQuery, InstrumentationEvents) && span.IsRecording()
+
+	if !op.firstRowAt.IsZero() {
+		if metrics {
+			t.timeToFirstRowDuration.Record(ctx, op.firstRowAt.Sub(op.startedAt).Seconds(), attrs)
+		}
+		if events {
+			span.AddEvent("pgx.first_row", trace.WithTimestamp(op.firstRowAt))
+		}
+	}
+
+	if !op.completedAt.IsZero() {
+		if metrics {
+			t.serverTimeDuration.Record(ctx, op.completedAt.Sub(op.startedAt).Seconds(), attrs)
+		}
+		if events {
+			span.AddEvent("pgx.response_complete", trace.WithTimestamp(op.completedAt))
+		}
+	}
+}
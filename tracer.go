@@ -5,9 +5,15 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"io"
+	"net"
+	"runtime"
 	"runtime/debug"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"weak"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -21,9 +27,13 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
+// ScopeName is the instrumentation scope name of the tracer and meter used by
+// this package, e.g. to match its instruments in metric views.
+const ScopeName = "github.com/exaring/otelpgx"
+
 const (
-	tracerName = "github.com/exaring/otelpgx"
-	meterName  = "github.com/exaring/otelpgx"
+	tracerName = ScopeName
+	meterName  = ScopeName
 )
 
 const (
@@ -53,11 +63,257 @@ const (
 	PGXOperationTypeKey = attribute.Key("pgx.operation.type")
 	// DBClientOperationErrorsKey represents the count of operation errors
 	DBClientOperationErrorsKey = attribute.Key("db.client.operation.errors")
+	// DBClientOperationsActiveKey represents the number of currently executing operations
+	DBClientOperationsActiveKey = attribute.Key("db.client.operations.active")
+	// PoolEmptyAcquireKey represents whether a connection acquire found no
+	// idle connection in the pool and had to wait for one to be released or
+	// constructed. Determining it takes the pool statistics, and thereby the
+	// pool lock, once more per acquire.
+	PoolEmptyAcquireKey = attribute.Key("pgx.pool.empty_acquire")
+	// DBClientOperationBatchSizeKey represents the number of queries per batch
+	DBClientOperationBatchSizeKey = attribute.Key("db.client.operation.batch.size")
+	// DBClientOperationBatchQueriesKey represents the count of queries sent via batches
+	DBClientOperationBatchQueriesKey = attribute.Key("db.client.operation.batch.queries")
+	// SQLStateClassKey represents the class of a PostgreSQL error code, i.e.
+	// its first two characters.
+	SQLStateClassKey = attribute.Key("pgx.sql_state.class")
+	// CancelReasonKey represents why an operation was canceled or timed out,
+	// one of "context_canceled", "context_deadline_exceeded",
+	// "statement_timeout", "query_canceled" or "timeout".
+	CancelReasonKey = attribute.Key("pgx.cancel.reason")
+	// DBClientOperationCancellationsKey represents the count of canceled or timed out operations
+	DBClientOperationCancellationsKey = attribute.Key("db.client.operation.cancellations")
+	// DBClientResponseWarningsKey represents the count of warnings sent by the server
+	DBClientResponseWarningsKey = attribute.Key("db.client.response.warnings")
+)
+
+// Attribute keys of the PostgreSQL error fields included by WithPgErrorDetails,
+// see https://www.postgresql.org/docs/current/protocol-error-fields.html.
+const (
+	PgErrorSeverityKey     = attribute.Key("pgx.error.severity")
+	PgErrorMessageKey      = attribute.Key("pgx.error.message")
+	PgErrorDetailKey       = attribute.Key("pgx.error.detail")
+	PgErrorHintKey         = attribute.Key("pgx.error.hint")
+	PgErrorPositionKey     = attribute.Key("pgx.error.position")
+	PgErrorWhereKey        = attribute.Key("pgx.error.where")
+	PgErrorSchemaNameKey   = attribute.Key("pgx.error.schema_name")
+	PgErrorTableNameKey    = attribute.Key("pgx.error.table_name")
+	PgErrorColumnNameKey   = attribute.Key("pgx.error.column_name")
+	PgErrorDataTypeNameKey = attribute.Key("pgx.error.data_type_name")
+	PgErrorConstraintKey   = attribute.Key("pgx.error.constraint_name")
+)
+
+const (
+	cancelReasonContextCanceled  = "context_canceled"
+	cancelReasonContextDeadline  = "context_deadline_exceeded"
+	cancelReasonStatementTimeout = "statement_timeout"
+	cancelReasonQueryCanceled    = "query_canceled"
+	cancelReasonTimeout          = "timeout"
 )
 
-type startTimeCtxKey struct{}
+// sqlStateQueryCanceled is the SQLSTATE of statements canceled by the server,
+// either on request or due to statement_timeout.
+const sqlStateQueryCanceled = "57014"
+
+// returnedRowsBuckets are the histogram bucket boundaries used for
+// db.client.response.returned_rows, as recommended by the semantic conventions.
+var returnedRowsBuckets = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000, 10000}
+
+// batchSizeBuckets are the histogram bucket boundaries used for
+// db.client.operation.batch.size.
+var batchSizeBuckets = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000}
+
+// connectionWaitTimeBuckets are the histogram bucket boundaries in seconds
+// used for db.client.connection.wait_time. They are finer than the SDK default
+// boundaries to capture fast acquires from a warm pool.
+var connectionWaitTimeBuckets = []float64{
+	0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+}
+
+type operationCtxKey struct{}
+
+// operationMetricKey identifies the attribute set of an operation metric.
+// Fields of attributes which are not enabled remain empty.
+type operationMetricKey struct {
+	operation      string
+	operationName  string
+	collectionName string
+	namespace      string
+	serverAddress  string
+	serverPort     int
+	errorType      string
+	statusCode     string
+}
+
+// operationErrorKey identifies the attribute set of the operation error count.
+type operationErrorKey struct {
+	operation     string
+	errorType     string
+	sqlStateClass string
+	cancelReason  string
+}
+
+// operation is the state of a single operation between its start and end
+// hooks. Every operation stores its own record in the context, so that the end
+// hooks never pick up the state of an enclosing operation, e.g. of a query
+// during which a connection is acquired.
+type operation struct {
+	pgxOperation string
+	startTime    time.Time
+
+	// span is the span started for the operation, or nil if none was started.
+	span trace.Span
+	// rootSpan is the root span of the operation while it is deferred until
+	// the end of the operation, see WithRootSpans.
+	rootSpan *deferredSpan
+
+	activeAttrs attribute.Set
+	key         operationMetricKey
+
+	// stmt is the SQL statement of query operations.
+	stmt string
+
+	// netConn is the network connection of the operation if its DialFunc has
+	// been instrumented, with its byte counts at the start of the operation.
+	netConn       *countingConn
+	bytesSent     int64
+	bytesReceived int64
+
+	// sniffer is the connection of a query if its response is timed, see
+	// WithTimeToFirstRow. The times are set while reading the response.
+	sniffer     *sniffingReader
+	startedAt   time.Time
+	firstRowAt  time.Time
+	completedAt time.Time
+
+	// connect is the state of connect operations.
+	connect *connectState
+
+	// emptyPool and parentSpan are set for acquire operations. emptyPool
+	// reports whether the pool had no idle connections at the start, and
+	// parentSpan is the span the connection is acquired in, if recording.
+	emptyPool  bool
+	parentSpan trace.Span
+}
+
+// noopSpan is returned as the span of operations without a span.
+var noopSpan = trace.SpanFromContext(context.Background())
+
+// operationFromContext returns the record of the operation of type
+// pgxOperation stored in ctx by its start hook, or nil if there is none.
+func operationFromContext(ctx context.Context, pgxOperation string) *operation {
+	op, ok := ctx.Value(operationCtxKey{}).(*operation)
+	if !ok || op.pgxOperation != pgxOperation {
+		return nil
+	}
+	return op
+}
+
+// traceSpan returns the span of op, or a non-recording span if op is nil or no
+// span was started for it.
+func (op *operation) traceSpan() trace.Span {
+	if op == nil || op.span == nil {
+		return noopSpan
+	}
+	return op.span
+}
+
+// deferredSpan is a root span which is only started at the end of its
+// operation if the RootSpanFilter accepts it.
+type deferredSpan struct {
+	name   string
+	config trace.SpanConfig
+}
+
+// startsSpan reports whether a span is started for an operation of type
+// pgxOperation in ctx, either as a child of the recording span in ctx or as a
+// root span if ctx is not part of any trace.
+func (t *Tracer) startsSpan(ctx context.Context, pgxOperation string) bool {
+	if !t.enabled(pgxOperation, InstrumentationSpans) {
+		return false
+	}
+
+	span := trace.SpanFromContext(ctx)
+	if span.IsRecording() {
+		return true
+	}
+	return t.rootSpans && pgxOperation != pgxOperationAcquire && !span.SpanContext().IsValid()
+}
+
+// startSpan starts the span of op as a child of the span in ctx. Root spans
+// are deferred to the end of the operation if a RootSpanFilter is configured.
+func (t *Tracer) startSpan(ctx context.Context, op *operation, name string, opts ...trace.SpanStartOption) context.Context {
+	if t.rootSpanFilter != nil && !trace.SpanContextFromContext(ctx).IsValid() {
+		// The options are resolved, as the attribute slices are reused once
+		// the start hook returns.
+		op.rootSpan = &deferredSpan{name: name, config: trace.NewSpanStartConfig(opts...)}
+		return ctx
+	}
+
+	ctx, op.span = t.tracer.Start(ctx, name, opts...)
+	return ctx
+}
+
+// startDeferredSpan starts the deferred root span of op, if any, with the
+// start time of op if it is accepted by the RootSpanFilter.
+func (t *Tracer) startDeferredSpan(ctx context.Context, op *operation, err error) {
+	if op == nil || op.rootSpan == nil {
+		return
+	}
+
+	deferred := op.rootSpan
+	op.rootSpan = nil
+	if !t.rootSpanFilter(Operation(op.pgxOperation), time.Since(op.startTime), err) {
+		return
+	}
+
+	_, op.span = t.tracer.Start(ctx, deferred.name,
+		trace.WithTimestamp(op.startTime),
+		trace.WithSpanKind(deferred.config.SpanKind()),
+		trace.WithAttributes(deferred.config.Attributes()...),
+		trace.WithLinks(deferred.config.Links()...),
+	)
+}
+
+var pgxOperations = []string{
+	pgxOperationQuery,
+	pgxOperationCopy,
+	pgxOperationBatch,
+	pgxOperationConnect,
+	pgxOperationPrepare,
+	pgxOperationAcquire,
+}
+
+// poolAttributeSets holds the precomputed metric attribute sets for a pool.
+type poolAttributeSets struct {
+	// server holds the server details of the pool. They are kept as the pool
+	// copies its config on every access.
+	server metricServer
+
+	base         attribute.Set
+	operations   map[string]attribute.Set
+	emptyAcquire attribute.Set
+	readyAcquire attribute.Set
+}
+
+var (
+	_ pgxpool.AcquireTracer = (*Tracer)(nil)
+	_ pgxpool.ReleaseTracer = (*Tracer)(nil)
+)
 
-var _ pgxpool.AcquireTracer = (*Tracer)(nil)
+// heldConnDataKey is the key of the heldConn in the custom data of a
+// connection which has been acquired from a pool.
+const heldConnDataKey = "otelpgx.held_conn"
+
+// heldConn tracks a connection which has been acquired from a pool and not yet
+// released back to it. It is stored in the custom data of the connection, so
+// that it is collected along with connections which are hijacked from the pool
+// and therefore never released.
+type heldConn struct {
+	acquiredAt time.Time
+	span       trace.Span
+	attrs      *poolAttributeSets
+}
 
 // Tracer is a wrapper around the pgx tracer interfaces which instrument
 // queries with both tracing and metrics.
@@ -71,9 +327,45 @@ type Tracer struct {
 	spanStartOptionsPool sync.Pool
 	attributeSlicePool   sync.Pool
 	metricAttrs          map[string]attribute.Set
+	metricAttributes     MetricAttribute
+	operationMetricAttrs struct {
+		sync.RWMutex
+		m map[operationMetricKey]attribute.Set
+	}
+	operationErrorAttrs struct {
+		sync.RWMutex
+		m map[operationErrorKey]attribute.Set
+	}
 
 	operationDuration dbconv.ClientOperationDuration
 	operationErrors   metric.Int64Counter
+	cancellations     metric.Int64Counter
+	operationsActive  metric.Int64UpDownCounter
+	returnedRows      dbconv.ClientResponseReturnedRows
+	batchSize         metric.Int64Histogram
+	batchQueries      metric.Int64Counter
+	connectionUseTime dbconv.ClientConnectionUseTime
+
+	connectionPendingRequests dbconv.ClientConnectionPendingRequests
+	connectionWaitTime        dbconv.ClientConnectionWaitTime
+	connectionCreateTime      dbconv.ClientConnectionCreateTime
+	connectPhaseDuration      metric.Float64Histogram
+	noPoolAttrs               *poolAttributeSets
+	poolMetricAttrs           sync.Map // map[weak.Pointer[pgxpool.Pool]]*poolAttributeSets
+
+	// activeSpans tracks the span of the operation in progress on each
+	// connection once notices are instrumented, see InstrumentNotices.
+	activeSpans      sync.Map // map[*pgconn.PgConn]trace.Span
+	noticesEnabled   atomic.Bool
+	noticeWarnings   metric.Int64Counter
+	noticeWarningSet sync.Map // map[string]attribute.Set
+
+	timeToFirstRowDuration metric.Float64Histogram
+	serverTimeDuration     metric.Float64Histogram
+
+	networkIOEnabled atomic.Bool
+	networkIO        metric.Int64Counter
+	networkIOAttrs   sync.Map // map[string]attribute.Set
 
 	trimQuerySpanName    bool
 	spanNameCtxFunc      SpanNameCtxFunc
@@ -81,7 +373,19 @@ type Tracer struct {
 	logSQLStatement      bool
 	logConnectionDetails bool
 	includeParams        bool
-	disableAcquireTracer bool
+	instrumentation      map[string]Instrumentation
+	rootSpans            bool
+	rootSpanFilter       RootSpanFilter
+	errorTypeFunc        ErrorTypeFunc
+	pgErrorDetails       bool
+	pgErrorRedactFunc    PgErrorRedactFunc
+	serverIdentity       bool
+	timeToFirstRow       bool
+	poolName             string
+	errorClassifiers     []ErrorClassifier
+
+	histogramBuckets         map[string][]float64
+	durationHistogramBuckets []float64
 }
 
 type tracerConfig struct {
@@ -97,7 +401,20 @@ type tracerConfig struct {
 	logSQLStatement      bool
 	logConnectionDetails bool
 	includeParams        bool
-	disableAcquireTracer bool
+	instrumentation      map[string]Instrumentation
+	rootSpans            bool
+	rootSpanFilter       RootSpanFilter
+	metricAttributes     MetricAttribute
+	errorTypeFunc        ErrorTypeFunc
+	pgErrorDetails       bool
+	pgErrorRedactFunc    PgErrorRedactFunc
+	serverIdentity       bool
+	timeToFirstRow       bool
+	poolName             string
+	errorClassifiers     []ErrorClassifier
+
+	histogramBuckets         map[string][]float64
+	durationHistogramBuckets []float64
 }
 
 // NewTracer returns a new Tracer.
@@ -117,7 +434,7 @@ func NewTracer(opts ...Option) *Tracer {
 		logSQLStatement:      true,
 		logConnectionDetails: true,
 		includeParams:        false,
-		disableAcquireTracer: false,
+		metricAttributes:     defaultMetricAttributes,
 	}
 
 	for _, opt := range opts {
@@ -147,7 +464,28 @@ func NewTracer(opts ...Option) *Tracer {
 		logSQLStatement:      cfg.logSQLStatement,
 		logConnectionDetails: cfg.logConnectionDetails,
 		includeParams:        cfg.includeParams,
-		disableAcquireTracer: cfg.disableAcquireTracer,
+		instrumentation:      make(map[string]Instrumentation, len(pgxOperations)),
+		rootSpans:            cfg.rootSpans,
+		rootSpanFilter:       cfg.rootSpanFilter,
+		metricAttributes:     cfg.metricAttributes,
+		errorTypeFunc:        cfg.errorTypeFunc,
+		pgErrorDetails:       cfg.pgErrorDetails,
+		pgErrorRedactFunc:    cfg.pgErrorRedactFunc,
+		serverIdentity:       cfg.serverIdentity,
+		timeToFirstRow:       cfg.timeToFirstRow,
+		poolName:             cfg.poolName,
+		errorClassifiers:     cfg.errorClassifiers,
+
+		histogramBuckets:         cfg.histogramBuckets,
+		durationHistogramBuckets: cfg.durationHistogramBuckets,
+	}
+
+	for _, op := range pgxOperations {
+		instrumentation, ok := cfg.instrumentation[op]
+		if !ok {
+			instrumentation = InstrumentationAll
+		}
+		tracer.instrumentation[op] = instrumentation
 	}
 
 	tracer.createMetrics()
@@ -161,7 +499,10 @@ func NewTracer(opts ...Option) *Tracer {
 func (t *Tracer) createMetrics() {
 	var err error
 
-	t.operationDuration, err = dbconv.NewClientOperationDuration(t.meter)
+	t.operationDuration, err = dbconv.NewClientOperationDuration(
+		t.meter,
+		t.durationHistogramOptions(dbconv.ClientOperationDuration{}.Name(), nil)...,
+	)
 	if err != nil {
 		otel.Handle(err)
 	}
@@ -173,54 +514,683 @@ func (t *Tracer) createMetrics() {
 	if err != nil {
 		otel.Handle(err)
 	}
+
+	t.cancellations, err = t.meter.Int64Counter(
+		string(DBClientOperationCancellationsKey),
+		metric.WithDescription("The count of database client operations canceled or timed out"),
+		metric.WithUnit("{operation}"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	t.noticeWarnings, err = t.meter.Int64Counter(
+		string(DBClientResponseWarningsKey),
+		metric.WithDescription("The count of warnings sent by the server"),
+		metric.WithUnit("{warning}"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	t.timeToFirstRowDuration, err = t.meter.Float64Histogram(
+		string(DBClientResponseTimeToFirstRowKey),
+		append([]metric.Float64HistogramOption{
+			metric.WithDescription("Duration from the start of a query until its first row is received"),
+			metric.WithUnit("s"),
+		}, t.durationHistogramOptions(string(DBClientResponseTimeToFirstRowKey), nil)...)...,
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	t.serverTimeDuration, err = t.meter.Float64Histogram(
+		string(DBClientResponseServerTimeKey),
+		append([]metric.Float64HistogramOption{
+			metric.WithDescription("Duration from the start of a query until its complete result is received"),
+			metric.WithUnit("s"),
+		}, t.durationHistogramOptions(string(DBClientResponseServerTimeKey), nil)...)...,
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	t.networkIO, err = t.meter.Int64Counter(
+		string(DBClientNetworkIOKey),
+		metric.WithDescription("The count of bytes sent and received over database connections"),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	t.operationsActive, err = t.meter.Int64UpDownCounter(
+		string(DBClientOperationsActiveKey),
+		metric.WithDescription("The number of currently executing database client operations"),
+		metric.WithUnit("{operation}"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	t.returnedRows, err = dbconv.NewClientResponseReturnedRows(
+		t.meter,
+		t.int64HistogramOptions(dbconv.ClientResponseReturnedRows{}.Name(), returnedRowsBuckets)...,
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	t.batchSize, err = t.meter.Int64Histogram(
+		string(DBClientOperationBatchSizeKey),
+		append([]metric.Int64HistogramOption{
+			metric.WithDescription("The number of queries sent in a single batch"),
+			metric.WithUnit("{query}"),
+		}, t.int64HistogramOptions(string(DBClientOperationBatchSizeKey), batchSizeBuckets)...)...,
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	t.batchQueries, err = t.meter.Int64Counter(
+		string(DBClientOperationBatchQueriesKey),
+		metric.WithDescription("The count of queries sent via batches"),
+		metric.WithUnit("{query}"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	t.connectPhaseDuration, err = t.meter.Float64Histogram(
+		string(DBClientConnectionPhaseDurationKey),
+		append([]metric.Float64HistogramOption{
+			metric.WithDescription("The duration of the phases of establishing a connection"),
+			metric.WithUnit("s"),
+		}, t.durationHistogramOptions(string(DBClientConnectionPhaseDurationKey), connectionWaitTimeBuckets)...)...,
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	t.connectionUseTime, err = dbconv.NewClientConnectionUseTime(
+		t.meter,
+		t.durationHistogramOptions(dbconv.ClientConnectionUseTime{}.Name(), nil)...,
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	t.connectionPendingRequests, err = dbconv.NewClientConnectionPendingRequests(t.meter)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	t.connectionWaitTime, err = dbconv.NewClientConnectionWaitTime(
+		t.meter,
+		t.durationHistogramOptions(dbconv.ClientConnectionWaitTime{}.Name(), connectionWaitTimeBuckets)...,
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	t.connectionCreateTime, err = dbconv.NewClientConnectionCreateTime(
+		t.meter,
+		t.durationHistogramOptions(dbconv.ClientConnectionCreateTime{}.Name(), nil)...,
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+}
+
+// durationHistogramOptions returns the options for the duration histogram with
+// the given name. Bucket boundaries configured for the name take precedence over
+// those configured for all duration histograms, which take precedence over
+// defaultBuckets. If no boundaries are configured at all, the SDK defaults apply.
+func (t *Tracer) durationHistogramOptions(name string, defaultBuckets []float64) []metric.Float64HistogramOption {
+	buckets := defaultBuckets
+	if t.durationHistogramBuckets != nil {
+		buckets = t.durationHistogramBuckets
+	}
+	if b, ok := t.histogramBuckets[name]; ok {
+		buckets = b
+	}
+
+	if buckets == nil {
+		return nil
+	}
+	return []metric.Float64HistogramOption{metric.WithExplicitBucketBoundaries(buckets...)}
+}
+
+// int64HistogramOptions returns the options for the histogram with the given
+// name. Bucket boundaries configured for the name take precedence over
+// defaultBuckets.
+func (t *Tracer) int64HistogramOptions(name string, defaultBuckets []float64) []metric.Int64HistogramOption {
+	buckets := defaultBuckets
+	if b, ok := t.histogramBuckets[name]; ok {
+		buckets = b
+	}
+
+	if buckets == nil {
+		return nil
+	}
+	return []metric.Int64HistogramOption{metric.WithExplicitBucketBoundaries(buckets...)}
 }
 
 func (t *Tracer) createAttributeSets() {
 	t.metricAttrs = make(map[string]attribute.Set)
-	operations := []string{
-		pgxOperationQuery,
-		pgxOperationCopy,
-		pgxOperationBatch,
-		pgxOperationConnect,
-		pgxOperationPrepare,
-		pgxOperationAcquire,
+	for _, op := range pgxOperations {
+		t.metricAttrs[op] = attribute.NewSet(withAttributes(t.meterAttrs, PGXOperationTypeKey.String(op))...)
+	}
+	t.noPoolAttrs = t.newPoolAttributeSets(nil, "")
+}
+
+// poolAttributeSets returns the metric attributes for the given pool, which are
+// the meter attributes extended by the pool name. The sets are computed once per
+// pool and cached afterwards.
+//
+// The sets of pools registered via RegisterStats use the registered pool name
+// and are cached with the registration, so they are dropped on Unregister. The
+// sets of other pools are cached until the pool is garbage collected.
+func (t *Tracer) poolAttributeSets(pool *pgxpool.Pool) *poolAttributeSets {
+	if pool == nil {
+		return t.noPoolAttrs
+	}
+
+	if v, ok := registeredPools.Load(pool); ok {
+		reg := v.(*poolRegistration)
+		if sets, ok := reg.attrs.Load(t); ok {
+			return sets.(*poolAttributeSets)
+		}
+
+		actual, _ := reg.attrs.LoadOrStore(t, t.newPoolAttributeSets(pool.Config().ConnConfig, t.poolNameOr(reg.name)))
+		return actual.(*poolAttributeSets)
+	}
+
+	key := weak.Make(pool)
+	if sets, ok := t.poolMetricAttrs.Load(key); ok {
+		return sets.(*poolAttributeSets)
+	}
+
+	cfg := pool.Config()
+	actual, loaded := t.poolMetricAttrs.LoadOrStore(key, t.newPoolAttributeSets(cfg.ConnConfig, t.poolNameOr(poolNameFromConfig(cfg))))
+	if !loaded {
+		runtime.AddCleanup(pool, func(key weak.Pointer[pgxpool.Pool]) {
+			t.poolMetricAttrs.Delete(key)
+		}, key)
+	}
+	return actual.(*poolAttributeSets)
+}
+
+// poolNameOr returns the pool name set via WithPoolName, or name if none is set.
+func (t *Tracer) poolNameOr(name string) string {
+	if t.poolName != "" {
+		return t.poolName
+	}
+	return name
+}
+
+// connectPoolName returns the pool name of the metrics of a connection being
+// established with config. See WithPoolName.
+func (t *Tracer) connectPoolName(config *pgconn.Config) string {
+	return t.poolNameOr(registeredPoolName(poolNameFromConnConfig(config)))
+}
+
+// newPoolAttributeSets computes the metric attributes of a pool with the given
+// connection config and name. Without a name, the pool name is omitted.
+func (t *Tracer) newPoolAttributeSets(connConfig *pgx.ConnConfig, name string) *poolAttributeSets {
+	attrs := make([]attribute.KeyValue, 0, len(t.meterAttrs)+2)
+	attrs = append(attrs, t.meterAttrs...)
+	if name != "" {
+		attrs = append(attrs, semconv.DBClientConnectionPoolName(name))
+	}
+
+	sets := &poolAttributeSets{
+		server:       metricServerFromConfig(connConfig),
+		base:         attribute.NewSet(withAttributes(attrs)...),
+		operations:   make(map[string]attribute.Set, len(pgxOperations)),
+		emptyAcquire: attribute.NewSet(withAttributes(attrs, PoolEmptyAcquireKey.Bool(true))...),
+		readyAcquire: attribute.NewSet(withAttributes(attrs, PoolEmptyAcquireKey.Bool(false))...),
+	}
+
+	for _, op := range pgxOperations {
+		sets.operations[op] = attribute.NewSet(withAttributes(attrs, PGXOperationTypeKey.String(op))...)
+	}
+
+	return sets
+}
+
+// connOperationAttributeSet returns the metric attributes for an operation on
+// conn. If conn has been acquired from a pool, the pool name is included.
+func (t *Tracer) connOperationAttributeSet(conn *pgx.Conn, pgxOperation string) attribute.Set {
+	if held := heldConnection(conn); held != nil {
+		return held.attrs.operations[pgxOperation]
+	}
+	return t.metricAttrs[pgxOperation]
+}
+
+// heldConnection returns the heldConn of conn, or nil if conn has not been
+// acquired from a pool.
+func heldConnection(conn *pgx.Conn) *heldConn {
+	if conn == nil || conn.PgConn() == nil {
+		return nil
+	}
+	held, _ := conn.PgConn().CustomData()[heldConnDataKey].(*heldConn)
+	return held
+}
+
+// enabled reports whether any of the given instrumentation is enabled for
+// operations of type pgxOperation.
+func (t *Tracer) enabled(pgxOperation string, instrumentation Instrumentation) bool {
+	return t.instrumentation[pgxOperation]&instrumentation != 0
+}
+
+// startOperation increments the number of active operations with the given
+// attributes, and stores the record of the operation in the returned context
+// for the end hook.
+func (t *Tracer) startOperation(ctx context.Context, activeAttrs attribute.Set, key operationMetricKey, stmt string) (context.Context, *operation) {
+	op := &operation{
+		pgxOperation: key.operation,
+		startTime:    time.Now(),
+		activeAttrs:  activeAttrs,
+		key:          key,
+		stmt:         stmt,
+	}
+	if t.enabled(key.operation, InstrumentationMetrics) {
+		t.operationsActive.Add(ctx, 1, metric.WithAttributeSet(activeAttrs))
+	}
+	return context.WithValue(ctx, operationCtxKey{}, op), op
+}
+
+// endOperationMetrics decrements the number of active operations started by
+// startOperation.
+func (t *Tracer) endOperationMetrics(ctx context.Context, op *operation) {
+	if op != nil && t.enabled(op.pgxOperation, InstrumentationMetrics) {
+		t.operationsActive.Add(ctx, -1, metric.WithAttributeSet(op.activeAttrs))
+	}
+}
+
+// newOperationMetricKey returns the key of the enabled operation metric
+// attributes for an operation on a connection to the given server. The
+// operation name is derived from stmt, if not empty.
+func (t *Tracer) newOperationMetricKey(ctx context.Context, pgxOperation string, server metricServer, stmt, collection string) operationMetricKey {
+	key := operationMetricKey{operation: pgxOperation}
+
+	if t.metricAttributes&MetricAttributeNamespace != 0 {
+		key.namespace = server.namespace
+	}
+	if t.metricAttributes&MetricAttributeServerAddress != 0 {
+		key.serverAddress = server.address
+	}
+	if t.metricAttributes&MetricAttributeServerPort != 0 {
+		key.serverPort = server.port
+	}
+
+	if stmt != "" && t.metricAttributes&MetricAttributeOperationName != 0 {
+		key.operationName = t.spanNameCtxFunc(ctx, stmt)
+	}
+
+	if t.metricAttributes&MetricAttributeCollectionName != 0 {
+		key.collectionName = collection
+	}
+
+	return key
+}
+
+// operationAttributeSet returns the attribute set for key, computing and
+// caching it on first use.
+func (t *Tracer) operationAttributeSet(key operationMetricKey) attribute.Set {
+	if key == (operationMetricKey{operation: key.operation}) {
+		return t.metricAttrs[key.operation]
+	}
+
+	t.operationMetricAttrs.RLock()
+	set, ok := t.operationMetricAttrs.m[key]
+	t.operationMetricAttrs.RUnlock()
+	if ok {
+		return set
+	}
+
+	attrs := withAttributes(t.meterAttrs, PGXOperationTypeKey.String(key.operation))
+	if key.operationName != "" {
+		attrs = append(attrs, semconv.DBOperationName(key.operationName))
+	}
+	if key.collectionName != "" {
+		attrs = append(attrs, semconv.DBCollectionName(key.collectionName))
+	}
+	if key.namespace != "" {
+		attrs = append(attrs, semconv.DBNamespace(key.namespace))
+	}
+	if key.serverAddress != "" {
+		attrs = append(attrs, semconv.ServerAddress(key.serverAddress))
+	}
+	if key.serverPort != 0 {
+		attrs = append(attrs, semconv.ServerPort(key.serverPort))
+	}
+	if key.errorType != "" {
+		attrs = append(attrs, semconv.ErrorTypeKey.String(key.errorType))
+	}
+	if key.statusCode != "" {
+		attrs = append(attrs, semconv.DBResponseStatusCode(key.statusCode))
+	}
+	set = attribute.NewSet(attrs...)
+
+	t.operationMetricAttrs.Lock()
+	if t.operationMetricAttrs.m == nil {
+		t.operationMetricAttrs.m = make(map[operationMetricKey]attribute.Set)
 	}
-	for _, op := range operations {
-		attrs := append(t.meterAttrs, PGXOperationTypeKey.String(op))
-		t.metricAttrs[op] = attribute.NewSet(attrs...)
+	t.operationMetricAttrs.m[key] = set
+	t.operationMetricAttrs.Unlock()
+
+	return set
+}
+
+// withAttributes returns a new slice holding attrs followed by extra. As
+// attribute.NewSet sorts its input in place, this is used to derive several
+// sets from the same base attributes.
+func withAttributes(attrs []attribute.KeyValue, extra ...attribute.KeyValue) []attribute.KeyValue {
+	out := make([]attribute.KeyValue, 0, len(attrs)+len(extra))
+	out = append(out, attrs...)
+	return append(out, extra...)
+}
+
+// classifyError returns how err is recorded, as decided by the configured
+// error classifiers. By default, sql.ErrNoRows is ignored and all other errors
+// are handled as ErrorHandlingError.
+func (t *Tracer) classifyError(err error) ErrorHandling {
+	if err == nil {
+		return ErrorHandlingIgnore
 	}
+
+	for _, classify := range t.errorClassifiers {
+		if handling, ok := classify(err); ok {
+			return handling
+		}
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrorHandlingIgnore
+	}
+	return ErrorHandlingError
 }
 
-// recordSpanError handles all error handling to be applied on the provided span.
-// The provided error must be non-nil and not a sql.ErrNoRows error.
-// Otherwise, recordSpanError will be a no-op.
-func recordSpanError(span trace.Span, err error) {
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		span.RecordError(err)
-		span.SetStatus(codes.Error, err.Error())
+// recordSpanError handles all error handling to be applied on the provided span,
+// as classified by classifyError. Ignored errors are not recorded. The
+// error.type, db.response.status_code and pgx.cancel.reason attributes mark the
+// operation as failed, so they are only set on the span along with the error
+// status. The cancel reason is always recorded on the exception event.
+func (t *Tracer) recordSpanError(span trace.Span, pgxOperation string, err error) {
+	handling := t.classifyError(err)
+	if handling&(ErrorHandlingSetStatus|ErrorHandlingRecordEvent) != 0 {
+		failed := handling&ErrorHandlingSetStatus != 0
+		reason := cancelReason(err)
+		if handling&ErrorHandlingRecordEvent != 0 && t.enabled(pgxOperation, InstrumentationEvents) {
+			if reason != "" {
+				span.RecordError(err, trace.WithAttributes(CancelReasonKey.String(reason)))
+			} else {
+				span.RecordError(err)
+			}
+		}
+		if failed {
+			span.SetStatus(codes.Error, err.Error())
+			span.SetAttributes(semconv.ErrorTypeKey.String(t.errorType(err)))
+			if reason != "" {
+				span.SetAttributes(CancelReasonKey.String(reason))
+			}
+		}
 
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) {
 			span.SetAttributes(SQLStateKey.String(pgErr.Code))
+			if failed {
+				span.SetAttributes(semconv.DBResponseStatusCode(pgErr.Code))
+			}
+
+			if t.pgErrorDetails {
+				span.SetAttributes(t.pgErrorAttributes(pgErr)...)
+			}
 		}
 	}
 }
 
+// pgErrorAttributes returns the non-empty fields of pgErr as attributes,
+// redacted by the configured PgErrorRedactFunc.
+func (t *Tracer) pgErrorAttributes(pgErr *pgconn.PgError) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, 11)
+
+	for _, field := range []struct {
+		key   attribute.Key
+		value string
+	}{
+		{PgErrorSeverityKey, pgErr.Severity},
+		{PgErrorMessageKey, pgErr.Message},
+		{PgErrorDetailKey, pgErr.Detail},
+		{PgErrorHintKey, pgErr.Hint},
+		{PgErrorWhereKey, pgErr.Where},
+		{PgErrorSchemaNameKey, pgErr.SchemaName},
+		{PgErrorTableNameKey, pgErr.TableName},
+		{PgErrorColumnNameKey, pgErr.ColumnName},
+		{PgErrorDataTypeNameKey, pgErr.DataTypeName},
+		{PgErrorConstraintKey, pgErr.ConstraintName},
+	} {
+		if value := t.redactPgErrorField(field.key, field.value); value != "" {
+			attrs = append(attrs, field.key.String(value))
+		}
+	}
+
+	if pgErr.Position != 0 {
+		attrs = append(attrs, PgErrorPositionKey.Int(int(pgErr.Position)))
+	}
+
+	return attrs
+}
+
+// redactPgErrorField returns value redacted by the configured PgErrorRedactFunc.
+func (t *Tracer) redactPgErrorField(key attribute.Key, value string) string {
+	if value == "" || t.pgErrorRedactFunc == nil {
+		return value
+	}
+	return t.pgErrorRedactFunc(key, value)
+}
+
 // incrementOperationErrorCount will increment the operation error count metric for any provided error
-// that is non-nil and not sql.ErrNoRows. Otherwise, incrementOperationErrorCount becomes a no-op.
+// classified as counted. Otherwise, incrementOperationErrorCount becomes a no-op.
+// Cancellations which are not ignored are additionally counted in the cancellation metric.
 func (t *Tracer) incrementOperationErrorCount(ctx context.Context, err error, pgxOperation string) {
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		t.operationErrors.Add(ctx, 1, metric.WithAttributeSet(
-			t.metricAttrs[pgxOperation],
+	if !t.enabled(pgxOperation, InstrumentationMetrics) {
+		return
+	}
+
+	handling := t.classifyError(err)
+	if handling == ErrorHandlingIgnore {
+		return
+	}
+
+	if reason := cancelReason(err); reason != "" {
+		t.cancellations.Add(ctx, 1, metric.WithAttributeSet(
+			t.operationErrorAttributeSet(operationErrorKey{operation: pgxOperation, cancelReason: reason}),
 		))
 	}
+
+	if handling&ErrorHandlingCount == 0 {
+		return
+	}
+
+	key := operationErrorKey{operation: pgxOperation, errorType: t.errorType(err)}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && len(pgErr.Code) >= 2 {
+		key.sqlStateClass = pgErr.Code[:2]
+	}
+
+	t.operationErrors.Add(ctx, 1, metric.WithAttributeSet(t.operationErrorAttributeSet(key)))
+}
+
+// operationErrorAttributeSet returns the cached attribute set of the operation
+// error count identified by key.
+func (t *Tracer) operationErrorAttributeSet(key operationErrorKey) attribute.Set {
+	t.operationErrorAttrs.RLock()
+	set, ok := t.operationErrorAttrs.m[key]
+	t.operationErrorAttrs.RUnlock()
+	if ok {
+		return set
+	}
+
+	attrs := withAttributes(t.meterAttrs, PGXOperationTypeKey.String(key.operation))
+	if key.errorType != "" {
+		attrs = append(attrs, semconv.ErrorTypeKey.String(key.errorType))
+	}
+	if key.sqlStateClass != "" {
+		attrs = append(attrs, SQLStateClassKey.String(key.sqlStateClass))
+	}
+	if key.cancelReason != "" {
+		attrs = append(attrs, CancelReasonKey.String(key.cancelReason))
+	}
+	set = attribute.NewSet(attrs...)
+
+	t.operationErrorAttrs.Lock()
+	if t.operationErrorAttrs.m == nil {
+		t.operationErrorAttrs.m = make(map[operationErrorKey]attribute.Set)
+	}
+	t.operationErrorAttrs.m[key] = set
+	t.operationErrorAttrs.Unlock()
+
+	return set
 }
 
 // recordOperationDuration will compute and record the time since the start of an operation.
-func (t *Tracer) recordOperationDuration(ctx context.Context, pgxOperation string) {
-	if startTime, ok := ctx.Value(startTimeCtxKey{}).(time.Time); ok {
-		t.operationDuration.RecordSet(ctx, time.Since(startTime).Seconds(), t.metricAttrs[pgxOperation])
+// The error.type and db.response.status_code attributes are derived from err, if enabled.
+func (t *Tracer) recordOperationDuration(ctx context.Context, op *operation, err error) {
+	if op == nil || !t.enabled(op.pgxOperation, InstrumentationMetrics) {
+		return
+	}
+
+	key := op.key
+
+	if t.classifyError(err)&ErrorHandlingCount != 0 {
+		if t.metricAttributes&MetricAttributeErrorType != 0 {
+			key.errorType = t.errorType(err)
+		}
+
+		var pgErr *pgconn.PgError
+		if t.metricAttributes&MetricAttributeResponseStatusCode != 0 && errors.As(err, &pgErr) {
+			key.statusCode = pgErr.Code
+		}
+	}
+
+	t.operationDuration.RecordSet(ctx, time.Since(op.startTime).Seconds(), t.operationAttributeSet(key))
+}
+
+// incrementBatchQueryCount increments the count of queries sent via batches,
+// using the pool and operation attributes of the batch op.
+func (t *Tracer) incrementBatchQueryCount(ctx context.Context, op *operation) {
+	if !t.enabled(pgxOperationBatch, InstrumentationMetrics) {
+		return
+	}
+
+	attrs := t.metricAttrs[pgxOperationBatch]
+	if op != nil {
+		attrs = op.activeAttrs
+	}
+	t.batchQueries.Add(ctx, 1, metric.WithAttributeSet(attrs))
+}
+
+// recordReturnedRows records the number of rows returned by a query statement
+// in the db.client.response.returned_rows histogram and on the span. The rows
+// affected by INSERT, UPDATE, DELETE and MERGE statements are only considered
+// returned if the statement has a RETURNING clause.
+func (t *Tracer) recordReturnedRows(ctx context.Context, span trace.Span, op *operation, pgxOperation, stmt string, commandTag pgconn.CommandTag) {
+	key := operationMetricKey{operation: pgxOperation}
+	if op != nil {
+		key = op.key
+		if stmt == "" {
+			stmt = op.stmt
+		}
+	}
+
+	if !commandTag.Select() && !hasReturningClause(commandTag, stmt) {
+		return
+	}
+
+	rows := commandTag.RowsAffected()
+	if t.enabled(pgxOperation, InstrumentationMetrics) {
+		t.returnedRows.RecordSet(ctx, rows, t.operationAttributeSet(key))
+	}
+
+	if span.IsRecording() {
+		span.SetAttributes(semconv.DBResponseReturnedRows(int(rows)))
+	}
+}
+
+// hasReturningClause reports whether stmt is a data-modifying statement with a
+// RETURNING clause. This is a heuristic, as stmt is not parsed: a RETURNING
+// keyword within a string literal or quoted identifier is also matched.
+func hasReturningClause(commandTag pgconn.CommandTag, stmt string) bool {
+	if !commandTag.Insert() && !commandTag.Update() && !commandTag.Delete() && !strings.HasPrefix(commandTag.String(), "MERGE") {
+		return false
+	}
+
+	const keyword = "returning"
+	for i := 0; i+len(keyword) <= len(stmt); i++ {
+		end := i + len(keyword)
+		if strings.EqualFold(stmt[i:end], keyword) &&
+			(i == 0 || !isIdentifierByte(stmt[i-1])) &&
+			(end == len(stmt) || !isIdentifierByte(stmt[end])) {
+			return true
+		}
+	}
+	return false
+}
+
+// isIdentifierByte reports whether c may be part of an unquoted identifier or
+// keyword. Bytes of multi-byte UTF-8 characters are considered part of an
+// identifier.
+func isIdentifierByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 ||
+		'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// metricServerDataKey is the key of the cached metricServer in the custom data
+// of a connection.
+const metricServerDataKey = "otelpgx.metric_server"
+
+// metricServer holds the server details of a connection which are used as
+// operation metric attributes.
+type metricServer struct {
+	namespace string
+	address   string
+	port      int
+}
+
+// metricServerFromConfig returns the server details of config, or none if
+// config is nil.
+func metricServerFromConfig(config *pgx.ConnConfig) metricServer {
+	if config == nil {
+		return metricServer{}
+	}
+	return metricServer{namespace: config.Database, address: config.Host, port: int(config.Port)}
+}
+
+// connMetricServer returns the server details of conn. They are computed once
+// and cached with the connection, as conn.Config() copies the config.
+func connMetricServer(conn *pgx.Conn) metricServer {
+	if conn == nil {
+		return metricServer{}
+	}
+
+	pgConn := conn.PgConn()
+	if pgConn == nil {
+		return metricServerFromConfig(conn.Config())
 	}
+
+	data := pgConn.CustomData()
+	if server, ok := data[metricServerDataKey].(metricServer); ok {
+		return server
+	}
+
+	server := metricServerFromConfig(conn.Config())
+	if data != nil {
+		data[metricServerDataKey] = server
+	}
+	return server
 }
 
 // connectionAttributesFromConfig returns a SpanStartOption that contains
@@ -241,9 +1211,12 @@ func connectionAttributesFromConfig(config *pgx.ConnConfig) []attribute.KeyValue
 // TraceQueryStart is called at the beginning of Query, QueryRow, and Exec calls.
 // The returned context is used for the rest of the call and will be passed to TraceQueryEnd.
 func (t *Tracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
-	ctx = context.WithValue(ctx, startTimeCtxKey{}, time.Now())
+	ctx, op := t.startOperation(ctx, t.connOperationAttributeSet(conn, pgxOperationQuery),
+		t.newOperationMetricKey(ctx, pgxOperationQuery, connMetricServer(conn), data.SQL, ""), data.SQL)
+	t.startNetworkIO(op, conn)
+	t.startResponseTiming(op, conn)
 
-	if !trace.SpanFromContext(ctx).IsRecording() {
+	if !t.startsSpan(ctx, pgxOperationQuery) {
 		return ctx
 	}
 
@@ -259,7 +1232,11 @@ func (t *Tracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.T
 	attrs = append(attrs, t.tracerAttrs...)
 
 	if t.logConnectionDetails && conn != nil {
-		attrs = append(attrs, connectionAttributesFromConfig(conn.Config())...)
+		attrs = append(attrs, connectionAttributes(conn)...)
+	}
+
+	if t.serverIdentity && conn != nil {
+		attrs = append(attrs, serverIdentityAttributes(conn)...)
 	}
 
 	if t.logSQLStatement {
@@ -287,22 +1264,33 @@ func (t *Tracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.T
 		spanName = "query " + spanName
 	}
 
-	ctx, _ = t.tracer.Start(ctx, spanName, opts...)
+	ctx = t.startSpan(ctx, op, spanName, opts...)
+	t.setActiveSpan(conn, op)
 
 	return ctx
 }
 
 // TraceQueryEnd is called at the end of Query, QueryRow, and Exec calls.
-func (t *Tracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
-	span := trace.SpanFromContext(ctx)
+func (t *Tracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	op := operationFromContext(ctx, pgxOperationQuery)
+	t.startDeferredSpan(ctx, op, data.Err)
+	span := op.traceSpan()
 	t.incrementOperationErrorCount(ctx, data.Err, pgxOperationQuery)
-	t.recordOperationDuration(ctx, pgxOperationQuery)
+	t.recordOperationDuration(ctx, op, data.Err)
+	t.endOperationMetrics(ctx, op)
+	t.endResponseTiming(ctx, op, span)
 
+	if data.Err == nil {
+		t.recordReturnedRows(ctx, span, op, pgxOperationQuery, "", data.CommandTag)
+	}
+
+	t.clearActiveSpan(conn, span)
 	if !span.IsRecording() {
 		return
 	}
 
-	recordSpanError(span, data.Err)
+	t.endNetworkIO(op, span)
+	t.recordSpanError(span, pgxOperationQuery, data.Err)
 
 	if data.Err == nil {
 		span.SetAttributes(RowsAffectedKey.Int64(data.CommandTag.RowsAffected()))
@@ -315,9 +1303,11 @@ func (t *Tracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQ
 // returned context is used for the rest of the call and will be passed to
 // TraceCopyFromEnd.
 func (t *Tracer) TraceCopyFromStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
-	ctx = context.WithValue(ctx, startTimeCtxKey{}, time.Now())
+	ctx, op := t.startOperation(ctx, t.connOperationAttributeSet(conn, pgxOperationCopy),
+		t.newOperationMetricKey(ctx, pgxOperationCopy, connMetricServer(conn), "", data.TableName.Sanitize()), "")
+	t.startNetworkIO(op, conn)
 
-	if !trace.SpanFromContext(ctx).IsRecording() {
+	if !t.startsSpan(ctx, pgxOperationCopy) {
 		return ctx
 	}
 
@@ -334,7 +1324,11 @@ func (t *Tracer) TraceCopyFromStart(ctx context.Context, conn *pgx.Conn, data pg
 	attrs = append(attrs, semconv.DBCollectionName(data.TableName.Sanitize()))
 
 	if t.logConnectionDetails && conn != nil {
-		attrs = append(attrs, connectionAttributesFromConfig(conn.Config())...)
+		attrs = append(attrs, connectionAttributes(conn)...)
+	}
+
+	if t.serverIdentity && conn != nil {
+		attrs = append(attrs, serverIdentityAttributes(conn)...)
 	}
 
 	opts = append(opts,
@@ -342,26 +1336,33 @@ func (t *Tracer) TraceCopyFromStart(ctx context.Context, conn *pgx.Conn, data pg
 		trace.WithAttributes(attrs...),
 	)
 
-	ctx, _ = t.tracer.Start(ctx, "copy_from "+data.TableName.Sanitize(), opts...)
+	ctx = t.startSpan(ctx, op, "copy_from "+data.TableName.Sanitize(), opts...)
+	t.setActiveSpan(conn, op)
 
 	return ctx
 }
 
 // TraceCopyFromEnd is called at the end of CopyFrom calls.
-func (t *Tracer) TraceCopyFromEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromEndData) {
-	span := trace.SpanFromContext(ctx)
+func (t *Tracer) TraceCopyFromEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	op := operationFromContext(ctx, pgxOperationCopy)
+	t.startDeferredSpan(ctx, op, data.Err)
+	span := op.traceSpan()
 	t.incrementOperationErrorCount(ctx, data.Err, pgxOperationCopy)
-	t.recordOperationDuration(ctx, pgxOperationCopy)
+	t.recordOperationDuration(ctx, op, data.Err)
+	t.endOperationMetrics(ctx, op)
 
+	t.clearActiveSpan(conn, span)
 	if !span.IsRecording() {
 		return
 	}
 
+	t.endNetworkIO(op, span)
+
 	if data.Err == nil {
 		span.SetAttributes(RowsAffectedKey.Int64(data.CommandTag.RowsAffected()))
 	}
 
-	recordSpanError(span, data.Err)
+	t.recordSpanError(span, pgxOperationCopy, data.Err)
 	span.End()
 }
 
@@ -369,16 +1370,22 @@ func (t *Tracer) TraceCopyFromEnd(ctx context.Context, _ *pgx.Conn, data pgx.Tra
 // context is used for the rest of the call and will be passed to
 // TraceBatchQuery and TraceBatchEnd.
 func (t *Tracer) TraceBatchStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
-	ctx = context.WithValue(ctx, startTimeCtxKey{}, time.Now())
-
-	if !trace.SpanFromContext(ctx).IsRecording() {
-		return ctx
-	}
+	batchAttrs := t.connOperationAttributeSet(conn, pgxOperationBatch)
+	ctx, op := t.startOperation(ctx, batchAttrs,
+		t.newOperationMetricKey(ctx, pgxOperationBatch, connMetricServer(conn), "", ""), "")
+	t.startNetworkIO(op, conn)
 
 	var size int
 	if b := data.Batch; b != nil {
 		size = b.Len()
 	}
+	if t.enabled(pgxOperationBatch, InstrumentationMetrics) {
+		t.batchSize.Record(ctx, int64(size), metric.WithAttributeSet(batchAttrs))
+	}
+
+	if !t.startsSpan(ctx, pgxOperationBatch) {
+		return ctx
+	}
 
 	optsP := t.spanStartOptionsPool.Get().(*[]trace.SpanStartOption)
 	defer t.spanStartOptionsPool.Put(optsP)
@@ -393,7 +1400,11 @@ func (t *Tracer) TraceBatchStart(ctx context.Context, conn *pgx.Conn, data pgx.T
 	attrs = append(attrs, semconv.DBOperationBatchSize(size))
 
 	if t.logConnectionDetails && conn != nil {
-		attrs = append(attrs, connectionAttributesFromConfig(conn.Config())...)
+		attrs = append(attrs, connectionAttributes(conn)...)
+	}
+
+	if t.serverIdentity && conn != nil {
+		attrs = append(attrs, serverIdentityAttributes(conn)...)
 	}
 
 	opts = append(opts,
@@ -401,16 +1412,22 @@ func (t *Tracer) TraceBatchStart(ctx context.Context, conn *pgx.Conn, data pgx.T
 		trace.WithAttributes(attrs...),
 	)
 
-	ctx, _ = t.tracer.Start(ctx, "batch start", opts...)
+	ctx = t.startSpan(ctx, op, "batch start", opts...)
+	t.setActiveSpan(conn, op)
 
 	return ctx
 }
 
 // TraceBatchQuery is called at the after each query in a batch.
 func (t *Tracer) TraceBatchQuery(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchQueryData) {
+	op := operationFromContext(ctx, pgxOperationBatch)
 	t.incrementOperationErrorCount(ctx, data.Err, pgxOperationBatch)
+	t.incrementBatchQueryCount(ctx, op)
 
-	if !trace.SpanFromContext(ctx).IsRecording() {
+	if !op.traceSpan().IsRecording() {
+		if data.Err == nil {
+			t.recordReturnedRows(ctx, noopSpan, op, pgxOperationBatch, data.SQL, data.CommandTag)
+		}
 		return
 	}
 
@@ -426,7 +1443,11 @@ func (t *Tracer) TraceBatchQuery(ctx context.Context, conn *pgx.Conn, data pgx.T
 	attrs = append(attrs, t.tracerAttrs...)
 
 	if t.logConnectionDetails && conn != nil {
-		attrs = append(attrs, connectionAttributesFromConfig(conn.Config())...)
+		attrs = append(attrs, connectionAttributes(conn)...)
+	}
+
+	if t.serverIdentity && conn != nil {
+		attrs = append(attrs, serverIdentityAttributes(conn)...)
 	}
 
 	if t.logSQLStatement {
@@ -459,32 +1480,62 @@ func (t *Tracer) TraceBatchQuery(ctx context.Context, conn *pgx.Conn, data pgx.T
 	}
 
 	_, span := t.tracer.Start(ctx, spanName, opts...)
-	recordSpanError(span, data.Err)
+	t.recordSpanError(span, pgxOperationBatch, data.Err)
+
+	if data.Err == nil {
+		t.recordReturnedRows(ctx, span, op, pgxOperationBatch, data.SQL, data.CommandTag)
+	}
 
 	span.End()
 }
 
 // TraceBatchEnd is called at the end of SendBatch calls.
-func (t *Tracer) TraceBatchEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchEndData) {
-	span := trace.SpanFromContext(ctx)
+func (t *Tracer) TraceBatchEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchEndData) {
+	op := operationFromContext(ctx, pgxOperationBatch)
+	t.startDeferredSpan(ctx, op, data.Err)
+	span := op.traceSpan()
 	t.incrementOperationErrorCount(ctx, data.Err, pgxOperationBatch)
-	t.recordOperationDuration(ctx, pgxOperationBatch)
+	t.recordOperationDuration(ctx, op, data.Err)
+	t.endOperationMetrics(ctx, op)
 
+	t.clearActiveSpan(conn, span)
 	if !span.IsRecording() {
 		return
 	}
 
-	recordSpanError(span, data.Err)
+	t.endNetworkIO(op, span)
+
+	t.recordSpanError(span, pgxOperationBatch, data.Err)
 	span.End()
 }
 
 // TraceConnectStart is called at the beginning of Connect and ConnectConfig
 // calls. The returned context is used for the rest of the call and will be
 // passed to TraceConnectEnd.
+// If the instrumentation of OperationConnect is disabled, then the function is
+// no-op and the connection config is left unchanged.
 func (t *Tracer) TraceConnectStart(ctx context.Context, data pgx.TraceConnectStartData) context.Context {
-	ctx = context.WithValue(ctx, startTimeCtxKey{}, time.Now())
+	if !t.enabled(pgxOperationConnect, InstrumentationAll) {
+		return ctx
+	}
+
+	var op *operation
+	if data.ConnConfig != nil {
+		state := t.instrumentConnect(data.ConnConfig)
+		ctx, op = t.startOperation(ctx,
+			attribute.NewSet(withAttributes(t.meterAttrs,
+				PGXOperationTypeKey.String(pgxOperationConnect),
+				semconv.DBClientConnectionPoolName(state.poolName),
+			)...),
+			t.newOperationMetricKey(ctx, pgxOperationConnect, metricServerFromConfig(data.ConnConfig), "", ""),
+			"",
+		)
+		op.connect = state
+	} else {
+		ctx, op = t.startOperation(ctx, t.metricAttrs[pgxOperationConnect], operationMetricKey{operation: pgxOperationConnect}, "")
+	}
 
-	if !trace.SpanFromContext(ctx).IsRecording() {
+	if !t.startsSpan(ctx, pgxOperationConnect) {
 		return ctx
 	}
 
@@ -508,32 +1559,95 @@ func (t *Tracer) TraceConnectStart(ctx context.Context, data pgx.TraceConnectSta
 		trace.WithAttributes(attrs...),
 	)
 
-	ctx, _ = t.tracer.Start(ctx, "connect", opts...)
+	ctx = t.startSpan(ctx, op, "connect", opts...)
 
 	return ctx
 }
 
 // TraceConnectEnd is called at the end of Connect and ConnectConfig calls.
+// If the instrumentation of OperationConnect is disabled, then the function is no-op.
 func (t *Tracer) TraceConnectEnd(ctx context.Context, data pgx.TraceConnectEndData) {
-	span := trace.SpanFromContext(ctx)
+	if !t.enabled(pgxOperationConnect, InstrumentationAll) {
+		return
+	}
+
+	op := operationFromContext(ctx, pgxOperationConnect)
+	t.startDeferredSpan(ctx, op, data.Err)
+	span := op.traceSpan()
 	t.incrementOperationErrorCount(ctx, data.Err, pgxOperationConnect)
-	t.recordOperationDuration(ctx, pgxOperationConnect)
+	t.recordOperationDuration(ctx, op, data.Err)
+	t.endOperationMetrics(ctx, op)
+
+	var state *connectState
+	if op != nil {
+		state = op.connect
+		if state != nil {
+			state.finish()
+		}
+		t.recordConnectionCreateTime(ctx, state, time.Since(op.startTime), data.Err)
+	}
+
+	if state != nil && data.Err == nil {
+		t.recordStartup(ctx, state)
+	}
+
+	if state != nil && data.Conn != nil {
+		cacheSniffer(data.Conn, state)
+	}
+
+	var connAttrs []attribute.KeyValue
+	if t.logConnectionDetails && state != nil && data.Conn != nil {
+		connAttrs = cacheConnectionAttributes(data.Conn, state)
+	}
 
 	if !span.IsRecording() {
 		return
 	}
 
-	recordSpanError(span, data.Err)
+	t.recordSpanError(span, pgxOperationConnect, data.Err)
+	span.SetAttributes(connAttrs...)
+	if state != nil {
+		span.SetAttributes(state.spanAttributes()...)
+	}
+
+	if t.serverIdentity && data.Conn != nil {
+		span.SetAttributes(serverIdentityAttributes(data.Conn)...)
+	}
+
 	span.End()
 }
 
+// recordConnectionCreateTime records the duration of a connect operation in
+// the db.client.connection.create_time histogram, including the server which
+// was connected to, the authentication method and the outcome.
+func (t *Tracer) recordConnectionCreateTime(ctx context.Context, state *connectState, elapsed time.Duration, err error) {
+	if !t.enabled(pgxOperationConnect, InstrumentationMetrics) {
+		return
+	}
+
+	attrs := make([]attribute.KeyValue, 0, len(t.meterAttrs)+5)
+	attrs = append(attrs, t.meterAttrs...)
+
+	if state != nil {
+		attrs = append(attrs, semconv.DBClientConnectionPoolName(state.poolName))
+		attrs = append(attrs, state.attributes()...)
+	}
+
+	if err != nil {
+		attrs = append(attrs, semconv.ErrorTypeKey.String(t.errorType(err)))
+	}
+
+	t.connectionCreateTime.RecordSet(ctx, elapsed.Seconds(), attribute.NewSet(attrs...))
+}
+
 // TracePrepareStart is called at the beginning of Prepare calls. The returned
 // context is used for the rest of the call and will be passed to
 // TracePrepareEnd.
 func (t *Tracer) TracePrepareStart(ctx context.Context, conn *pgx.Conn, data pgx.TracePrepareStartData) context.Context {
-	ctx = context.WithValue(ctx, startTimeCtxKey{}, time.Now())
+	ctx, op := t.startOperation(ctx, t.connOperationAttributeSet(conn, pgxOperationPrepare),
+		t.newOperationMetricKey(ctx, pgxOperationPrepare, connMetricServer(conn), data.SQL, ""), "")
 
-	if !trace.SpanFromContext(ctx).IsRecording() {
+	if !t.startsSpan(ctx, pgxOperationPrepare) {
 		return ctx
 	}
 
@@ -553,7 +1667,11 @@ func (t *Tracer) TracePrepareStart(ctx context.Context, conn *pgx.Conn, data pgx
 	}
 
 	if t.logConnectionDetails && conn != nil {
-		attrs = append(attrs, connectionAttributesFromConfig(conn.Config())...)
+		attrs = append(attrs, connectionAttributes(conn)...)
+	}
+
+	if t.serverIdentity && conn != nil {
+		attrs = append(attrs, serverIdentityAttributes(conn)...)
 	}
 
 	attrs = append(attrs, semconv.DBOperationName(t.spanNameCtxFunc(ctx, data.SQL)))
@@ -575,39 +1693,57 @@ func (t *Tracer) TracePrepareStart(ctx context.Context, conn *pgx.Conn, data pgx
 		spanName = "prepare " + spanName
 	}
 
-	ctx, _ = t.tracer.Start(ctx, spanName, opts...)
+	ctx = t.startSpan(ctx, op, spanName, opts...)
 
 	return ctx
 }
 
 // TracePrepareEnd is called at the end of Prepare calls.
 func (t *Tracer) TracePrepareEnd(ctx context.Context, _ *pgx.Conn, data pgx.TracePrepareEndData) {
-	span := trace.SpanFromContext(ctx)
+	op := operationFromContext(ctx, pgxOperationPrepare)
+	t.startDeferredSpan(ctx, op, data.Err)
+	span := op.traceSpan()
 	t.incrementOperationErrorCount(ctx, data.Err, pgxOperationPrepare)
-	t.recordOperationDuration(ctx, pgxOperationPrepare)
+	t.recordOperationDuration(ctx, op, data.Err)
+	t.endOperationMetrics(ctx, op)
 
 	if !span.IsRecording() {
 		return
 	}
 
-	recordSpanError(span, data.Err)
+	t.recordSpanError(span, pgxOperationPrepare, data.Err)
 	span.End()
 }
 
 // TraceAcquireStart is called at the beginning of Acquire.
 // The returned context is used for the rest of the call and will be passed to the TraceAcquireEnd.
-// If WithDisableAcquireTracer was set, then the function is no-op.
+// If the instrumentation of OperationAcquire is disabled, then the function is no-op.
 func (t *Tracer) TraceAcquireStart(ctx context.Context, pool *pgxpool.Pool, data pgxpool.TraceAcquireStartData) context.Context {
-	if t.disableAcquireTracer {
+	if !t.enabled(pgxOperationAcquire, InstrumentationAll) {
 		return ctx
 	}
 
-	ctx = context.WithValue(ctx, startTimeCtxKey{}, time.Now())
+	poolAttrs := t.poolAttributeSets(pool)
+	if t.enabled(pgxOperationAcquire, InstrumentationMetrics) {
+		t.connectionPendingRequests.AddSet(ctx, 1, poolAttrs.base)
+	}
+	ctx, op := t.startOperation(ctx, poolAttrs.operations[pgxOperationAcquire],
+		t.newOperationMetricKey(ctx, pgxOperationAcquire, poolAttrs.server, "", ""), "")
+
+	if pool != nil && t.enabled(pgxOperationAcquire, InstrumentationMetrics) {
+		// The pool statistics are only a snapshot, so concurrent acquires may
+		// race for the last idle connection. This is good enough to tell waits
+		// on an exhausted pool apart from regular acquires.
+		op.emptyPool = pool.Stat().IdleConns() == 0
+	}
 
-	if !trace.SpanFromContext(ctx).IsRecording() {
+	parentSpan := trace.SpanFromContext(ctx)
+	if !t.enabled(pgxOperationAcquire, InstrumentationSpans) || !parentSpan.IsRecording() {
 		return ctx
 	}
 
+	op.parentSpan = parentSpan
+
 	optsP := t.spanStartOptionsPool.Get().(*[]trace.SpanStartOption)
 	defer t.spanStartOptionsPool.Put(optsP)
 	attrsP := t.attributeSlicePool.Get().(*[]attribute.KeyValue)
@@ -628,30 +1764,187 @@ func (t *Tracer) TraceAcquireStart(ctx context.Context, pool *pgxpool.Pool, data
 		trace.WithAttributes(attrs...),
 	)
 
-	ctx, _ = t.tracer.Start(ctx, "pool.acquire", opts...)
+	ctx = t.startSpan(ctx, op, "pool.acquire", opts...)
 
 	return ctx
 }
 
 // TraceAcquireEnd is called when a connection has been acquired.
-// If WithDisableAcquireTracer was set, then the function is no-op.
-func (t *Tracer) TraceAcquireEnd(ctx context.Context, _ *pgxpool.Pool, data pgxpool.TraceAcquireEndData) {
-	if t.disableAcquireTracer {
+// If the instrumentation of OperationAcquire is disabled, then the function is no-op.
+func (t *Tracer) TraceAcquireEnd(ctx context.Context, pool *pgxpool.Pool, data pgxpool.TraceAcquireEndData) {
+	if !t.enabled(pgxOperationAcquire, InstrumentationAll) {
 		return
 	}
 
-	span := trace.SpanFromContext(ctx)
+	op := operationFromContext(ctx, pgxOperationAcquire)
+	span := op.traceSpan()
 	t.incrementOperationErrorCount(ctx, data.Err, pgxOperationAcquire)
-	t.recordOperationDuration(ctx, pgxOperationAcquire)
+	t.recordOperationDuration(ctx, op, data.Err)
+	t.endOperationMetrics(ctx, op)
+
+	poolAttrs := t.poolAttributeSets(pool)
+	metrics := t.enabled(pgxOperationAcquire, InstrumentationMetrics)
+	if metrics {
+		t.connectionPendingRequests.AddSet(ctx, -1, poolAttrs.base)
+	}
+
+	if metrics && op != nil && data.Err == nil {
+		waitAttrs := poolAttrs.readyAcquire
+		if op.emptyPool {
+			waitAttrs = poolAttrs.emptyAcquire
+		}
+		t.connectionWaitTime.RecordSet(ctx, time.Since(op.startTime).Seconds(), waitAttrs)
+	}
+
+	if data.Err == nil && data.Conn != nil {
+		t.startConnectionHold(ctx, op, pool, data.Conn)
+	}
 
 	if !span.IsRecording() {
 		return
 	}
 
-	recordSpanError(span, data.Err)
+	t.recordSpanError(span, pgxOperationAcquire, data.Err)
 	span.End()
 }
 
+// startConnectionHold remembers when conn was acquired from pool, so that
+// TraceRelease can compute how long it was held. If the acquire happened
+// within a recording span, a pool.connection.held span is started as a
+// sibling of the acquire span.
+func (t *Tracer) startConnectionHold(ctx context.Context, op *operation, pool *pgxpool.Pool, conn *pgx.Conn) {
+	held := &heldConn{
+		acquiredAt: time.Now(),
+		attrs:      t.poolAttributeSets(pool),
+	}
+
+	if op != nil && op.parentSpan != nil {
+		attrs := make([]attribute.KeyValue, 0, len(t.tracerAttrs)+5)
+		attrs = append(attrs, t.tracerAttrs...)
+		if t.logConnectionDetails {
+			attrs = append(attrs, connectionAttributes(conn)...)
+		}
+		if t.serverIdentity {
+			attrs = append(attrs, serverIdentityAttributes(conn)...)
+		}
+
+		_, held.span = t.tracer.Start(
+			trace.ContextWithSpan(ctx, op.parentSpan),
+			"pool.connection.held",
+			trace.WithSpanKind(trace.SpanKindInternal),
+			trace.WithAttributes(attrs...),
+		)
+	}
+
+	if pgConn := conn.PgConn(); pgConn != nil {
+		pgConn.CustomData()[heldConnDataKey] = held
+	}
+}
+
+// TraceRelease is called when a connection is released back to the pool. It
+// records the time the connection was held in the db.client.connection.use_time
+// histogram and ends the pool.connection.held span, if any.
+// Connections which are hijacked from the pool are never released and
+// therefore not recorded, and their pool.connection.held span is never ended
+// and thus not exported.
+// If the instrumentation of OperationAcquire is disabled, then the function is no-op.
+func (t *Tracer) TraceRelease(_ *pgxpool.Pool, data pgxpool.TraceReleaseData) {
+	if !t.enabled(pgxOperationAcquire, InstrumentationAll) || data.Conn == nil {
+		return
+	}
+
+	held := heldConnection(data.Conn)
+	if held == nil {
+		return
+	}
+	delete(data.Conn.PgConn().CustomData(), heldConnDataKey)
+
+	if t.enabled(pgxOperationAcquire, InstrumentationMetrics) {
+		t.connectionUseTime.RecordSet(context.Background(), time.Since(held.acquiredAt).Seconds(), held.attrs.base)
+	}
+
+	if held.span != nil {
+		held.span.End()
+	}
+}
+
+// errorType returns the value of the error.type attribute for err, as
+// classified by the configured ErrorTypeFunc or otherwise by errorType.
+func (t *Tracer) errorType(err error) string {
+	if t.errorTypeFunc != nil {
+		if typ := t.errorTypeFunc(err); typ != "" {
+			return typ
+		}
+	}
+	return errorType(err)
+}
+
+// errorType returns the value of the error.type attribute for err: the SQLSTATE
+// code for PostgreSQL errors, the name of well-known context, network and pgx
+// errors, or "_OTHER".
+func errorType(err error) string {
+	var (
+		pgErr      *pgconn.PgError
+		opErr      *net.OpError
+		netErr     net.Error
+		connectErr *pgconn.ConnectError
+		scanErr    pgx.ScanArgError
+		prepareErr *pgconn.PrepareError
+	)
+	switch {
+	case errors.As(err, &pgErr):
+		return pgErr.Code
+	case errors.Is(err, context.DeadlineExceeded):
+		return "context.DeadlineExceeded"
+	case errors.Is(err, context.Canceled):
+		return "context.Canceled"
+	case errors.Is(err, pgx.ErrTxClosed):
+		return "pgx.ErrTxClosed"
+	case errors.Is(err, pgx.ErrTxCommitRollback):
+		return "pgx.ErrTxCommitRollback"
+	case errors.Is(err, pgx.ErrTooManyRows):
+		return "pgx.ErrTooManyRows"
+	case errors.As(err, &scanErr):
+		return "pgx.ScanArgError"
+	case errors.As(err, &prepareErr):
+		return "pgconn.PrepareError"
+	case errors.As(err, &connectErr):
+		// Connect failures wrap the network error of the last attempt.
+		return "pgconn.ConnectError"
+	case errors.As(err, &opErr):
+		return "net.OpError"
+	case errors.As(err, &netErr):
+		return "net.Error"
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return "io.EOF"
+	default:
+		return semconv.ErrorTypeOther.Value.AsString()
+	}
+}
+
+// cancelReason returns the value of the pgx.cancel.reason attribute for err, or
+// an empty string if err is not caused by a cancellation or timeout. Statement
+// timeouts are told apart from other server side cancellations by the error
+// message, which is only reliable with English server messages.
+func cancelReason(err error) string {
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return cancelReasonContextCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return cancelReasonContextDeadline
+	case errors.As(err, &pgErr) && pgErr.Code == sqlStateQueryCanceled:
+		if strings.Contains(pgErr.Message, "statement timeout") {
+			return cancelReasonStatementTimeout
+		}
+		return cancelReasonQueryCanceled
+	case pgconn.Timeout(err):
+		return cancelReasonTimeout
+	default:
+		return ""
+	}
+}
+
 func makeParamsAttribute(args []any) attribute.KeyValue {
 	ss := make([]string, len(args))
 	for i := range args {
@@ -2,18 +2,29 @@ package otelpgx
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestTracer_sqlOperationName(t *testing.T) {
@@ -184,7 +195,9 @@ func TestTracer_sqlOperationNameFromCtx(t *testing.T) {
 
 // newMockConn creates a *pgx.Conn with the given connection details, backed
 // by a fake PostgreSQL server over net.Pipe — no real database needed.
-func newMockConn(t *testing.T, host string, port uint16, user, database string) *pgx.Conn {
+// The optional configure functions are applied to the connection config
+// before connecting.
+func newMockConn(t *testing.T, host string, port uint16, user, database string, configure ...func(*pgx.ConnConfig)) *pgx.Conn {
 	t.Helper()
 
 	client, server := net.Pipe()
@@ -207,7 +220,11 @@ func newMockConn(t *testing.T, host string, port uint16, user, database string)
 
 		for _, msg := range []pgproto3.BackendMessage{
 			&pgproto3.AuthenticationOk{},
-			&pgproto3.BackendKeyData{SecretKey: make([]byte, 4)},
+			&pgproto3.ParameterStatus{Name: "server_version", Value: "17.2"},
+			&pgproto3.ParameterStatus{Name: "application_name", Value: "otelpgx"},
+			&pgproto3.ParameterStatus{Name: "TimeZone", Value: "UTC"},
+			&pgproto3.ParameterStatus{Name: "server_encoding", Value: "UTF8"},
+			&pgproto3.BackendKeyData{ProcessID: 4242, SecretKey: make([]byte, 4)},
 			&pgproto3.ReadyForQuery{TxStatus: 'I'},
 		} {
 			b.Send(msg)
@@ -239,6 +256,9 @@ func newMockConn(t *testing.T, host string, port uint16, user, database string)
 	config.DialFunc = func(ctx context.Context, _, _ string) (net.Conn, error) {
 		return client, nil
 	}
+	for _, fn := range configure {
+		fn(config)
+	}
 
 	conn, err := pgx.ConnectConfig(context.Background(), config)
 	require.NoError(t, err)
@@ -255,6 +275,20 @@ func newMockConn(t *testing.T, host string, port uint16, user, database string)
 	return conn
 }
 
+// newTestPool returns a pool for dsn which is closed at the end of the test.
+// The pool does not connect until a connection is acquired.
+func newTestPool(t *testing.T, dsn string) *pgxpool.Pool {
+	t.Helper()
+
+	config, err := pgxpool.ParseConfig(dsn)
+	require.NoError(t, err)
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	return pool
+}
+
 // findAttr returns the value for the given key in the attribute slice, and
 // whether it was found.
 func findAttr(attrs []attribute.KeyValue, key string) (attribute.Value, bool) {
@@ -388,3 +422,1045 @@ func TestTracer_spanAttributes(t *testing.T) {
 		})
 	}
 }
+
+func TestTracer_TraceRelease(t *testing.T) {
+	conn := newMockConn(t, "fakehost", 5432, "fakeuser", "fakedb")
+
+	pool := newTestPool(t, "postgres://fakeuser@fakehost:5432/fakedb")
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { require.NoError(t, tp.Shutdown(context.Background())) })
+
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	tracer := NewTracer(WithTracerProvider(tp), WithMeterProvider(mp))
+
+	ctx, parentSpan := tp.Tracer("test").Start(context.Background(), "parent")
+	acquireCtx := tracer.TraceAcquireStart(ctx, pool, pgxpool.TraceAcquireStartData{})
+	tracer.TraceAcquireEnd(acquireCtx, pool, pgxpool.TraceAcquireEndData{Conn: conn})
+	tracer.TraceRelease(pool, pgxpool.TraceReleaseData{Conn: conn})
+	parentSpan.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+	require.Equal(t, "pool.acquire", spans[0].Name)
+	require.Equal(t, "pool.connection.held", spans[1].Name)
+	require.Equal(t, parentSpan.SpanContext().SpanID(), spans[1].Parent.SpanID())
+	require.Equal(t, trace.SpanKindInternal, spans[1].SpanKind)
+	require.NotContains(t, conn.PgConn().CustomData(), heldConnDataKey)
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	m, ok := findMetric(rm, "db.client.connection.use_time")
+	require.True(t, ok, "missing db.client.connection.use_time metric")
+	hist, ok := m.Data.(metricdata.Histogram[float64])
+	require.True(t, ok)
+	require.Len(t, hist.DataPoints, 1)
+	require.Equal(t, uint64(1), hist.DataPoints[0].Count)
+
+	poolName, ok := hist.DataPoints[0].Attributes.Value(semconv.DBClientConnectionPoolNameKey)
+	require.True(t, ok)
+	require.Equal(t, "fakehost:5432/fakedb", poolName.AsString())
+
+	// A second release of the same connection must not be recorded again.
+	tracer.TraceRelease(pool, pgxpool.TraceReleaseData{Conn: conn})
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	m, _ = findMetric(rm, "db.client.connection.use_time")
+	require.Equal(t, uint64(1), m.Data.(metricdata.Histogram[float64]).DataPoints[0].Count)
+}
+
+func TestTracer_poolAttributeSetsRegistration(t *testing.T) {
+	mp := sdkmetric.NewMeterProvider()
+	tracer := NewTracer(WithMeterProvider(mp))
+
+	poolName := func(pool *pgxpool.Pool) string {
+		v, _ := tracer.poolAttributeSets(pool).base.Value(semconv.DBClientConnectionPoolNameKey)
+		return v.AsString()
+	}
+
+	const dsn = "postgres://fakeuser@fakehost:5432/fakedb"
+	first, second := newTestPool(t, dsn), newTestPool(t, dsn)
+	reg1, err := RegisterStats(first, WithStatsMeterProvider(mp))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, reg1.Unregister()) })
+
+	// The second pool is used before it is registered, e.g. by a Ping.
+	require.Equal(t, "fakehost:5432/fakedb", poolName(second))
+
+	reg2, err := RegisterStats(second, WithStatsMeterProvider(mp))
+	require.NoError(t, err)
+	require.Equal(t, "fakehost:5432/fakedb#2", poolName(second))
+
+	v, ok := registeredPools.Load(second)
+	require.True(t, ok)
+	registration := v.(*poolRegistration)
+	_, ok = registration.attrs.Load(tracer)
+	require.True(t, ok, "missing cached attribute sets")
+
+	require.NoError(t, reg2.Unregister())
+	_, ok = registeredPools.Load(second)
+	require.False(t, ok, "registration not dropped on Unregister")
+	require.Equal(t, "fakehost:5432/fakedb", poolName(second))
+}
+
+// findMetric returns the metric with the given name from the collected
+// resource metrics, and whether it was found.
+func findMetric(rm metricdata.ResourceMetrics, name string) (metricdata.Metrics, bool) {
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m, true
+			}
+		}
+	}
+	return metricdata.Metrics{}, false
+}
+
+func TestTracer_connectionWaitTime(t *testing.T) {
+	conn := newMockConn(t, "fakehost", 5432, "fakeuser", "fakedb")
+
+	pool := newTestPool(t, "postgres://fakeuser@fakehost:5432/fakedb")
+
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	tracer := NewTracer(WithMeterProvider(mp))
+
+	// The pool has not established any connection yet, so the acquire hits
+	// an empty pool.
+	ctx := tracer.TraceAcquireStart(context.Background(), pool, pgxpool.TraceAcquireStartData{})
+	tracer.TraceAcquireEnd(ctx, pool, pgxpool.TraceAcquireEndData{Conn: conn})
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	m, ok := findMetric(rm, "db.client.connection.wait_time")
+	require.True(t, ok, "missing db.client.connection.wait_time metric")
+	hist := m.Data.(metricdata.Histogram[float64])
+	require.Len(t, hist.DataPoints, 1)
+	require.Equal(t, connectionWaitTimeBuckets, hist.DataPoints[0].Bounds)
+
+	empty, ok := hist.DataPoints[0].Attributes.Value(PoolEmptyAcquireKey)
+	require.True(t, ok)
+	require.True(t, empty.AsBool())
+
+	m, ok = findMetric(rm, "db.client.connection.pending_requests")
+	require.True(t, ok, "missing db.client.connection.pending_requests metric")
+	require.Equal(t, int64(0), m.Data.(metricdata.Sum[int64]).DataPoints[0].Value)
+}
+
+func TestTracer_operationsActive(t *testing.T) {
+	conn := newMockConn(t, "fakehost", 5432, "fakeuser", "fakedb")
+
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	tracer := NewTracer(WithMeterProvider(mp))
+
+	activeQueries := func() int64 {
+		var rm metricdata.ResourceMetrics
+		require.NoError(t, reader.Collect(context.Background(), &rm))
+
+		m, ok := findMetric(rm, string(DBClientOperationsActiveKey))
+		require.True(t, ok, "missing %s metric", DBClientOperationsActiveKey)
+		for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+			if op, _ := dp.Attributes.Value(PGXOperationTypeKey); op.AsString() == pgxOperationQuery {
+				return dp.Value
+			}
+		}
+		return 0
+	}
+
+	ctx1 := tracer.TraceQueryStart(context.Background(), conn, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	ctx2 := tracer.TraceQueryStart(context.Background(), conn, pgx.TraceQueryStartData{SQL: "SELECT 2"})
+	require.Equal(t, int64(2), activeQueries())
+
+	tracer.TraceQueryEnd(ctx1, conn, pgx.TraceQueryEndData{})
+	require.Equal(t, int64(1), activeQueries())
+
+	tracer.TraceQueryEnd(ctx2, conn, pgx.TraceQueryEndData{})
+	require.Equal(t, int64(0), activeQueries())
+}
+
+func TestTracer_instrumentation(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	tracer := NewTracer(
+		WithMeterProvider(mp),
+		WithTracerProvider(tp),
+		WithInstrumentation(OperationConnect, InstrumentationMetrics),
+		WithInstrumentation(OperationQuery, InstrumentationSpans),
+	)
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+
+	conn := newMockConn(t, "fakehost", 5432, "fakeuser", "fakedb", func(config *pgx.ConnConfig) {
+		config.Tracer = tracer
+	})
+	ctx = tracer.TraceQueryStart(ctx, conn, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	tracer.TraceQueryEnd(ctx, conn, pgx.TraceQueryEndData{Err: errors.New("boom")})
+	parent.End()
+
+	spans := sr.Ended()
+	require.Len(t, spans, 2)
+	require.Equal(t, "query SELECT 1", spans[0].Name())
+	require.Empty(t, spans[0].Events(), "unexpected events on query span")
+	require.Equal(t, "parent", spans[1].Name())
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	m, ok := findMetric(rm, "db.client.operation.duration")
+	require.True(t, ok, "missing db.client.operation.duration metric")
+	var ops []string
+	for _, dp := range m.Data.(metricdata.Histogram[float64]).DataPoints {
+		op, _ := dp.Attributes.Value(PGXOperationTypeKey)
+		ops = append(ops, op.AsString())
+	}
+	require.Equal(t, []string{pgxOperationConnect}, ops)
+
+	_, ok = findMetric(rm, "db.client.connection.create_time")
+	require.True(t, ok, "missing db.client.connection.create_time metric")
+}
+
+func TestTracer_connectInstrumentationDisabled(t *testing.T) {
+	tracer := NewTracer(WithInstrumentation(OperationConnect, InstrumentationNone))
+
+	config, err := pgx.ParseConfig("host=fakehost user=fakeuser dbname=fakedb sslmode=disable")
+	require.NoError(t, err)
+	config.LookupFunc = nil
+	config.DialFunc = nil
+
+	ctx := tracer.TraceConnectStart(context.Background(), pgx.TraceConnectStartData{ConnConfig: config})
+	require.Nil(t, config.LookupFunc)
+	require.Nil(t, config.DialFunc)
+	require.Nil(t, config.AfterNetConnect)
+	require.Nil(t, operationFromContext(ctx, pgxOperationConnect))
+
+	tracer.TraceConnectEnd(ctx, pgx.TraceConnectEndData{})
+}
+
+func TestTracer_rootSpans(t *testing.T) {
+	conn := newMockConn(t, "fakehost", 5432, "fakeuser", "fakedb")
+
+	errBoom := errors.New("boom")
+
+	tests := []struct {
+		name   string
+		filter RootSpanFilter
+		err    error
+		want   int
+	}{
+		{name: "all", want: 1},
+		{name: "on error without error", filter: RootSpansOnError()},
+		{name: "on error", filter: RootSpansOnError(), err: errBoom, want: 1},
+		{name: "slower than", filter: RootSpansSlowerThan(time.Millisecond), want: 1},
+		{name: "not slower than", filter: RootSpansSlowerThan(time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sr := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+			tracer := NewTracer(WithTracerProvider(tp), WithRootSpans(tt.filter))
+
+			start := time.Now()
+			ctx := tracer.TraceQueryStart(context.Background(), conn, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+			time.Sleep(2 * time.Millisecond)
+			tracer.TraceQueryEnd(ctx, conn, pgx.TraceQueryEndData{Err: tt.err})
+
+			spans := sr.Ended()
+			require.Len(t, spans, tt.want)
+			if tt.want == 0 {
+				return
+			}
+
+			span := spans[0]
+			require.Equal(t, "query SELECT 1", span.Name())
+			require.False(t, span.Parent().IsValid(), "expected root span")
+			require.False(t, span.StartTime().Before(start))
+			require.GreaterOrEqual(t, span.EndTime().Sub(span.StartTime()), 2*time.Millisecond)
+			attrs := attribute.NewSet(span.Attributes()...)
+			_, ok := attrs.Value(semconv.DBQueryTextKey)
+			require.True(t, ok, "missing attribute %q", semconv.DBQueryTextKey)
+			if tt.err != nil {
+				require.Equal(t, codes.Error, span.Status().Code)
+			}
+		})
+	}
+}
+
+func TestTracer_rootSpansUnsampled(t *testing.T) {
+	conn := newMockConn(t, "fakehost", 5432, "fakeuser", "fakedb")
+
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr), sdktrace.WithSampler(sdktrace.AlwaysSample()))
+
+	tracer := NewTracer(WithTracerProvider(tp), WithRootSpans(nil))
+
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  trace.SpanID{1},
+	}))
+	ctx = tracer.TraceQueryStart(ctx, conn, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	tracer.TraceQueryEnd(ctx, conn, pgx.TraceQueryEndData{})
+
+	require.Empty(t, sr.Ended())
+}
+
+func TestTracer_operationDurationAttributes(t *testing.T) {
+	conn := newMockConn(t, "fakehost", 5432, "fakeuser", "fakedb")
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		err     error
+		want    map[attribute.Key]string
+		wantInt map[attribute.Key]int64
+		absent  []attribute.Key
+	}{
+		{
+			name: "default",
+			want: map[attribute.Key]string{
+				semconv.DBNamespaceKey:   "fakedb",
+				semconv.ServerAddressKey: "fakehost",
+			},
+			wantInt: map[attribute.Key]int64{semconv.ServerPortKey: 5432},
+			absent:  []attribute.Key{semconv.DBOperationNameKey, semconv.ErrorTypeKey, semconv.DBResponseStatusCodeKey},
+		},
+		{
+			name: "error",
+			err:  &pgconn.PgError{Code: "23505"},
+			want: map[attribute.Key]string{
+				semconv.ErrorTypeKey:            "23505",
+				semconv.DBResponseStatusCodeKey: "23505",
+			},
+		},
+		{
+			name: "operation name enabled, server disabled",
+			opts: []Option{
+				WithMetricAttributes(MetricAttributeOperationName),
+				WithoutMetricAttributes(MetricAttributeServerAddress | MetricAttributeServerPort),
+			},
+			want:   map[attribute.Key]string{semconv.DBOperationNameKey: "SELECT"},
+			absent: []attribute.Key{semconv.ServerAddressKey, semconv.ServerPortKey},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := sdkmetric.NewManualReader()
+			mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+			tracer := NewTracer(append([]Option{WithMeterProvider(mp)}, tt.opts...)...)
+
+			ctx := tracer.TraceQueryStart(context.Background(), conn, pgx.TraceQueryStartData{SQL: "SELECT * FROM users"})
+			tracer.TraceQueryEnd(ctx, conn, pgx.TraceQueryEndData{Err: tt.err})
+
+			var rm metricdata.ResourceMetrics
+			require.NoError(t, reader.Collect(context.Background(), &rm))
+
+			m, ok := findMetric(rm, "db.client.operation.duration")
+			require.True(t, ok, "missing db.client.operation.duration metric")
+			hist := m.Data.(metricdata.Histogram[float64])
+			require.Len(t, hist.DataPoints, 1)
+			attrs := hist.DataPoints[0].Attributes
+
+			for key, want := range tt.want {
+				v, ok := attrs.Value(key)
+				require.Truef(t, ok, "missing attribute %q", key)
+				require.Equal(t, want, v.AsString())
+			}
+			for key, want := range tt.wantInt {
+				v, ok := attrs.Value(key)
+				require.Truef(t, ok, "missing attribute %q", key)
+				require.Equal(t, want, v.AsInt64())
+			}
+			for _, key := range tt.absent {
+				_, ok := attrs.Value(key)
+				require.Falsef(t, ok, "unexpected attribute %q", key)
+			}
+		})
+	}
+}
+
+func TestTracer_returnedRows(t *testing.T) {
+	conn := newMockConn(t, "fakehost", 5432, "fakeuser", "fakedb")
+
+	tests := []struct {
+		name       string
+		sql        string
+		commandTag string
+		want       int64
+		recorded   bool
+	}{
+		{name: "select", sql: "SELECT * FROM users", commandTag: "SELECT 3", want: 3, recorded: true},
+		{name: "insert returning", sql: "INSERT INTO users (name) VALUES ($1) returning id", commandTag: "INSERT 0 1", want: 1, recorded: true},
+		{name: "insert", sql: "INSERT INTO users (name) VALUES ($1)", commandTag: "INSERT 0 1"},
+		{name: "update", sql: "UPDATE users SET name = $1", commandTag: "UPDATE 5"},
+		{name: "update returning", sql: "UPDATE users SET name = $1\nRETURNING\tid", commandTag: "UPDATE 2", want: 2, recorded: true},
+		{name: "returning column", sql: "INSERT INTO users (returning_customer) VALUES ($1)", commandTag: "INSERT 0 1"},
+		{name: "returning suffix", sql: "UPDATE returnings SET name = $1", commandTag: "UPDATE 5"},
+		{name: "returning in identifier", sql: "DELETE FROM users WHERE is_returning", commandTag: "DELETE 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := sdkmetric.NewManualReader()
+			mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+			sr := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+			tracer := NewTracer(WithMeterProvider(mp), WithTracerProvider(tp))
+
+			ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+			ctx = tracer.TraceQueryStart(ctx, conn, pgx.TraceQueryStartData{SQL: tt.sql})
+			tracer.TraceQueryEnd(ctx, conn, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag(tt.commandTag)})
+			parent.End()
+
+			var rm metricdata.ResourceMetrics
+			require.NoError(t, reader.Collect(context.Background(), &rm))
+
+			m, ok := findMetric(rm, "db.client.response.returned_rows")
+			if !tt.recorded {
+				if ok {
+					require.Empty(t, m.Data.(metricdata.Histogram[int64]).DataPoints)
+				}
+			} else {
+				require.True(t, ok, "missing db.client.response.returned_rows metric")
+				hist := m.Data.(metricdata.Histogram[int64])
+				require.Len(t, hist.DataPoints, 1)
+				require.Equal(t, tt.want, hist.DataPoints[0].Sum)
+			}
+
+			spans := sr.Ended()
+			require.Len(t, spans, 2)
+			var found bool
+			for _, kv := range spans[0].Attributes() {
+				if kv.Key == semconv.DBResponseReturnedRowsKey {
+					found = true
+					require.Equal(t, tt.want, kv.Value.AsInt64())
+				}
+			}
+			require.Equal(t, tt.recorded, found)
+		})
+	}
+}
+
+func TestTracer_batchMetrics(t *testing.T) {
+	conn := newMockConn(t, "fakehost", 5432, "fakeuser", "fakedb")
+
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	tracer := NewTracer(WithMeterProvider(mp))
+
+	batch := &pgx.Batch{}
+	batch.Queue("SELECT 1")
+	batch.Queue("SELECT 2")
+	batch.Queue("SELECT 3")
+
+	ctx := tracer.TraceBatchStart(context.Background(), conn, pgx.TraceBatchStartData{Batch: batch})
+	for _, qq := range batch.QueuedQueries {
+		tracer.TraceBatchQuery(ctx, conn, pgx.TraceBatchQueryData{SQL: qq.SQL})
+	}
+	tracer.TraceBatchEnd(ctx, conn, pgx.TraceBatchEndData{})
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	m, ok := findMetric(rm, string(DBClientOperationBatchSizeKey))
+	require.True(t, ok, "missing %s metric", DBClientOperationBatchSizeKey)
+	hist := m.Data.(metricdata.Histogram[int64])
+	require.Len(t, hist.DataPoints, 1)
+	require.Equal(t, int64(3), hist.DataPoints[0].Sum)
+	op, ok := hist.DataPoints[0].Attributes.Value(PGXOperationTypeKey)
+	require.True(t, ok)
+	require.Equal(t, pgxOperationBatch, op.AsString())
+
+	m, ok = findMetric(rm, string(DBClientOperationBatchQueriesKey))
+	require.True(t, ok, "missing %s metric", DBClientOperationBatchQueriesKey)
+	sum := m.Data.(metricdata.Sum[int64])
+	require.Len(t, sum.DataPoints, 1)
+	require.Equal(t, int64(3), sum.DataPoints[0].Value)
+}
+
+func TestTracer_nestedOperations(t *testing.T) {
+	conn := newMockConn(t, "fakehost", 5432, "fakeuser", "fakedb")
+
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	tracer := NewTracer(WithMeterProvider(mp), WithTracerProvider(tp))
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	queryCtx := tracer.TraceQueryStart(ctx, conn, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+
+	// A prepare ending with the context of the query must neither end the
+	// query span nor record a duration.
+	tracer.TracePrepareEnd(queryCtx, conn, pgx.TracePrepareEndData{})
+	require.Empty(t, sr.Ended())
+
+	prepareCtx := tracer.TracePrepareStart(queryCtx, conn, pgx.TracePrepareStartData{SQL: "SELECT 1"})
+	tracer.TracePrepareEnd(prepareCtx, conn, pgx.TracePrepareEndData{})
+	tracer.TraceQueryEnd(queryCtx, conn, pgx.TraceQueryEndData{})
+	parent.End()
+
+	spans := sr.Ended()
+	require.Len(t, spans, 3)
+	require.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+	require.Equal(t, spans[2].SpanContext().SpanID(), spans[1].Parent().SpanID())
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	m, ok := findMetric(rm, "db.client.operation.duration")
+	require.True(t, ok, "missing db.client.operation.duration metric")
+	counts := make(map[string]uint64)
+	for _, dp := range m.Data.(metricdata.Histogram[float64]).DataPoints {
+		op, _ := dp.Attributes.Value(PGXOperationTypeKey)
+		counts[op.AsString()] += dp.Count
+	}
+	require.Equal(t, map[string]uint64{pgxOperationQuery: 1, pgxOperationPrepare: 1}, counts)
+}
+
+func TestTracer_operationErrors(t *testing.T) {
+	conn := newMockConn(t, "fakehost", 5432, "fakeuser", "fakedb")
+
+	errPaymentRequired := errors.New("payment required")
+
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	tracer := NewTracer(
+		WithMeterProvider(mp),
+		WithErrorTypeFunc(func(err error) string {
+			if errors.Is(err, errPaymentRequired) {
+				return "payment_required"
+			}
+			return ""
+		}),
+	)
+
+	for _, err := range []error{
+		&pgconn.PgError{Code: "23505"},
+		&pgconn.PgError{Code: "23505"},
+		&pgconn.PgError{Code: "23503"},
+		errPaymentRequired,
+		sql.ErrNoRows,
+	} {
+		ctx := tracer.TraceQueryStart(context.Background(), conn, pgx.TraceQueryStartData{SQL: "INSERT INTO users DEFAULT VALUES"})
+		tracer.TraceQueryEnd(ctx, conn, pgx.TraceQueryEndData{Err: err})
+	}
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	m, ok := findMetric(rm, string(DBClientOperationErrorsKey))
+	require.True(t, ok, "missing %s metric", DBClientOperationErrorsKey)
+
+	type point struct {
+		errorType, class string
+	}
+	got := make(map[point]int64)
+	for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+		errorType, _ := dp.Attributes.Value(semconv.ErrorTypeKey)
+		class, _ := dp.Attributes.Value(SQLStateClassKey)
+		got[point{errorType.AsString(), class.AsString()}] = dp.Value
+	}
+
+	require.Equal(t, map[point]int64{
+		{"23505", "23"}:          2,
+		{"23503", "23"}:          1,
+		{"payment_required", ""}: 1,
+	}, got)
+}
+
+func TestTracer_pgErrorDetails(t *testing.T) {
+	conn := newMockConn(t, "fakehost", 5432, "fakeuser", "fakedb")
+
+	pgErr := &pgconn.PgError{
+		Severity:       "ERROR",
+		Code:           "23505",
+		Message:        `duplicate key value violates unique constraint "users_email_key"`,
+		Detail:         "Key (email)=(jane@example.com) already exists.",
+		SchemaName:     "public",
+		TableName:      "users",
+		ConstraintName: "users_email_key",
+	}
+
+	tests := []struct {
+		name   string
+		opts   []Option
+		want   map[attribute.Key]string
+		absent []attribute.Key
+	}{
+		{
+			name: "default",
+			want: map[attribute.Key]string{
+				SQLStateKey:                     "23505",
+				semconv.DBResponseStatusCodeKey: "23505",
+				semconv.ErrorTypeKey:            "23505",
+			},
+			absent: []attribute.Key{PgErrorDetailKey, PgErrorConstraintKey},
+		},
+		{
+			name: "details",
+			opts: []Option{WithPgErrorDetails()},
+			want: map[attribute.Key]string{
+				semconv.DBResponseStatusCodeKey: "23505",
+				PgErrorSeverityKey:              "ERROR",
+				PgErrorDetailKey:                "Key (email)=(jane@example.com) already exists.",
+				PgErrorSchemaNameKey:            "public",
+				PgErrorTableNameKey:             "users",
+				PgErrorConstraintKey:            "users_email_key",
+			},
+		},
+		{
+			name: "redacted details",
+			opts: []Option{
+				WithPgErrorDetails(),
+				WithPgErrorRedactFunc(func(key attribute.Key, value string) string {
+					if key == PgErrorDetailKey {
+						return ""
+					}
+					return value
+				}),
+			},
+			want: map[attribute.Key]string{
+				PgErrorConstraintKey: "users_email_key",
+			},
+			absent: []attribute.Key{PgErrorDetailKey},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sr := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+			tracer := NewTracer(append([]Option{WithTracerProvider(tp)}, tt.opts...)...)
+
+			ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+			ctx = tracer.TraceQueryStart(ctx, conn, pgx.TraceQueryStartData{SQL: "INSERT INTO users (email) VALUES ($1)"})
+			tracer.TraceQueryEnd(ctx, conn, pgx.TraceQueryEndData{Err: pgErr})
+			parent.End()
+
+			spans := sr.Ended()
+			require.Len(t, spans, 2)
+			attrs := attribute.NewSet(spans[0].Attributes()...)
+
+			for key, want := range tt.want {
+				v, ok := attrs.Value(key)
+				require.Truef(t, ok, "missing attribute %q", key)
+				require.Equal(t, want, v.AsString())
+			}
+			for _, key := range tt.absent {
+				_, ok := attrs.Value(key)
+				require.Falsef(t, ok, "unexpected attribute %q", key)
+			}
+		})
+	}
+}
+
+func TestTracer_errorClassifier(t *testing.T) {
+	conn := newMockConn(t, "fakehost", 5432, "fakeuser", "fakedb")
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus codes.Code
+		wantEvents int
+		wantCount  int64
+	}{
+		{name: "unexpected", err: &pgconn.PgError{Code: "23503"}, wantStatus: codes.Error, wantEvents: 1, wantCount: 1},
+		{name: "expected SQLSTATE", err: &pgconn.PgError{Code: "23505"}, wantEvents: 1},
+		{name: "canceled", err: context.Canceled, wantEvents: 1},
+		{name: "ignored", err: errors.New("ignored")},
+		{name: "no rows", err: sql.ErrNoRows},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := sdkmetric.NewManualReader()
+			mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+			sr := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+			tracer := NewTracer(
+				WithTracerProvider(tp),
+				WithMeterProvider(mp),
+				WithErrorClassifier(
+					ExpectedSQLStates("23505", "40001"),
+					ExpectedContextCanceled(),
+					func(err error) (ErrorHandling, bool) {
+						return ErrorHandlingIgnore, err.Error() == "ignored"
+					},
+				),
+			)
+
+			ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+			ctx = tracer.TraceQueryStart(ctx, conn, pgx.TraceQueryStartData{SQL: "INSERT INTO users DEFAULT VALUES"})
+			tracer.TraceQueryEnd(ctx, conn, pgx.TraceQueryEndData{Err: tt.err})
+			parent.End()
+
+			spans := sr.Ended()
+			require.Len(t, spans, 2)
+			require.Equal(t, tt.wantStatus, spans[0].Status().Code)
+			require.Len(t, spans[0].Events(), tt.wantEvents)
+
+			var rm metricdata.ResourceMetrics
+			require.NoError(t, reader.Collect(context.Background(), &rm))
+
+			var count int64
+			if m, ok := findMetric(rm, string(DBClientOperationErrorsKey)); ok {
+				for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+					count += dp.Value
+				}
+			}
+			require.Equal(t, tt.wantCount, count)
+		})
+	}
+}
+
+func TestTracer_cancellations(t *testing.T) {
+	conn := newMockConn(t, "fakehost", 5432, "fakeuser", "fakedb")
+
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	tracer := NewTracer(
+		WithTracerProvider(tp),
+		WithMeterProvider(mp),
+		WithErrorClassifier(ExpectedCancellations()),
+	)
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	ctx = tracer.TraceQueryStart(ctx, conn, pgx.TraceQueryStartData{SQL: "SELECT pg_sleep(10)"})
+	tracer.TraceQueryEnd(ctx, conn, pgx.TraceQueryEndData{
+		Err: &pgconn.PgError{Code: "57014", Message: "canceling statement due to statement timeout"},
+	})
+	parent.End()
+
+	spans := sr.Ended()
+	require.Len(t, spans, 2)
+	require.Equal(t, codes.Unset, spans[0].Status().Code)
+	spanAttrs := attribute.NewSet(spans[0].Attributes()...)
+	for _, key := range []attribute.Key{CancelReasonKey, semconv.ErrorTypeKey, semconv.DBResponseStatusCodeKey} {
+		_, ok := spanAttrs.Value(key)
+		require.Falsef(t, ok, "unexpected attribute %q", key)
+	}
+	require.Len(t, spans[0].Events(), 1)
+	eventAttrs := attribute.NewSet(spans[0].Events()[0].Attributes...)
+	reason, ok := eventAttrs.Value(CancelReasonKey)
+	require.True(t, ok, "missing event attribute %q", CancelReasonKey)
+	require.Equal(t, "statement_timeout", reason.AsString())
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	m, ok := findMetric(rm, string(DBClientOperationCancellationsKey))
+	require.True(t, ok, "missing %s metric", DBClientOperationCancellationsKey)
+	sum := m.Data.(metricdata.Sum[int64])
+	require.Len(t, sum.DataPoints, 1)
+	require.Equal(t, int64(1), sum.DataPoints[0].Value)
+	reason, ok = sum.DataPoints[0].Attributes.Value(CancelReasonKey)
+	require.True(t, ok)
+	require.Equal(t, "statement_timeout", reason.AsString())
+
+	_, ok = findMetric(rm, string(DBClientOperationErrorsKey))
+	require.False(t, ok, "unexpected %s metric", DBClientOperationErrorsKey)
+}
+
+func TestTracer_histogramBuckets(t *testing.T) {
+	conn := newMockConn(t, "fakehost", 5432, "fakeuser", "fakedb")
+
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	durationBuckets := []float64{0.001, 0.01, 0.1}
+	operationBuckets := []float64{0.0001, 0.0005, 0.001}
+
+	tracer := NewTracer(
+		WithMeterProvider(mp),
+		WithDurationHistogramBuckets(durationBuckets...),
+		WithHistogramBuckets("db.client.operation.duration", operationBuckets...),
+	)
+
+	ctx := tracer.TraceQueryStart(context.Background(), conn, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	tracer.TraceQueryEnd(ctx, conn, pgx.TraceQueryEndData{})
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	m, ok := findMetric(rm, "db.client.operation.duration")
+	require.True(t, ok, "missing db.client.operation.duration metric")
+	require.Equal(t, operationBuckets, m.Data.(metricdata.Histogram[float64]).DataPoints[0].Bounds)
+}
+
+func TestTracer_InstrumentNotices(t *testing.T) {
+	conn := newMockConn(t, "fakehost", 5432, "fakeuser", "fakedb")
+
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	tracer := NewTracer(WithTracerProvider(tp), WithMeterProvider(mp))
+
+	var chained int
+	config := &pgconn.Config{
+		OnNotice: func(*pgconn.PgConn, *pgconn.Notice) { chained++ },
+	}
+	tracer.InstrumentNotices(config)
+
+	warning := &pgconn.Notice{Severity: "WARNING", Code: "01000", Message: "deprecated", Detail: "use v2"}
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	ctx = tracer.TraceQueryStart(ctx, conn, pgx.TraceQueryStartData{SQL: "SELECT do_work()"})
+	config.OnNotice(conn.PgConn(), &pgconn.Notice{Severity: "NOTICE", Code: "00000", Message: "working"})
+	config.OnNotice(conn.PgConn(), warning)
+	tracer.TraceQueryEnd(ctx, conn, pgx.TraceQueryEndData{})
+	parent.End()
+
+	// Notices outside of an operation are only counted.
+	config.OnNotice(conn.PgConn(), warning)
+
+	require.Equal(t, 3, chained)
+
+	spans := sr.Ended()
+	require.Len(t, spans, 2)
+	events := spans[0].Events()
+	require.Len(t, events, 2)
+	require.Equal(t, "pgx.notice", events[1].Name)
+	eventAttrs := attribute.NewSet(events[1].Attributes...)
+	detail, ok := eventAttrs.Value(PgErrorDetailKey)
+	require.True(t, ok)
+	require.Equal(t, "use v2", detail.AsString())
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	m, ok := findMetric(rm, string(DBClientResponseWarningsKey))
+	require.True(t, ok, "missing %s metric", DBClientResponseWarningsKey)
+	sum := m.Data.(metricdata.Sum[int64])
+	require.Len(t, sum.DataPoints, 1)
+	require.Equal(t, int64(2), sum.DataPoints[0].Value)
+	code, ok := sum.DataPoints[0].Attributes.Value(semconv.DBResponseStatusCodeKey)
+	require.True(t, ok)
+	require.Equal(t, "01000", code.AsString())
+}
+
+func TestTracer_InstrumentNoticesUnsampled(t *testing.T) {
+	conn := newMockConn(t, "fakehost", 5432, "fakeuser", "fakedb")
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(sdktrace.NeverSample()))
+	tracer := NewTracer(WithTracerProvider(tp), WithRootSpans(nil))
+	tracer.InstrumentNotices(&pgconn.Config{})
+
+	ctx := tracer.TraceQueryStart(context.Background(), conn, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	tracer.TraceQueryEnd(ctx, conn, pgx.TraceQueryEndData{})
+	ctx = tracer.TraceCopyFromStart(context.Background(), conn, pgx.TraceCopyFromStartData{TableName: pgx.Identifier{"t"}})
+	tracer.TraceCopyFromEnd(ctx, conn, pgx.TraceCopyFromEndData{})
+	ctx = tracer.TraceBatchStart(context.Background(), conn, pgx.TraceBatchStartData{})
+	tracer.TraceBatchEnd(ctx, conn, pgx.TraceBatchEndData{})
+
+	// Spans dropped by the sampler must not keep the connection in the Tracer.
+	var active int
+	tracer.activeSpans.Range(func(any, any) bool {
+		active++
+		return true
+	})
+	require.Zero(t, active)
+}
+
+func TestTracer_serverIdentityAttributes(t *testing.T) {
+	conn := newMockConn(t, "fakehost", 5432, "fakeuser", "fakedb")
+
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	tracer := NewTracer(WithTracerProvider(tp), WithServerIdentityAttributes())
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	ctx = tracer.TraceQueryStart(ctx, conn, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	tracer.TraceQueryEnd(ctx, conn, pgx.TraceQueryEndData{})
+	parent.End()
+
+	spans := sr.Ended()
+	require.Len(t, spans, 2)
+	attrs := attribute.NewSet(spans[0].Attributes()...)
+
+	for key, want := range map[attribute.Key]string{
+		ServerVersionKey:         "17.2",
+		ServerApplicationNameKey: "otelpgx",
+		ServerTimeZoneKey:        "UTC",
+		ServerEncodingKey:        "UTF8",
+	} {
+		v, ok := attrs.Value(key)
+		require.Truef(t, ok, "missing attribute %q", key)
+		require.Equal(t, want, v.AsString())
+	}
+
+	pid, ok := attrs.Value(BackendPIDKey)
+	require.True(t, ok, "missing attribute %q", BackendPIDKey)
+	require.Equal(t, int64(4242), pid.AsInt64())
+}
+
+func TestTracer_serverIdentityAttributesNilConn(t *testing.T) {
+	tp := sdktrace.NewTracerProvider()
+	tracer := NewTracer(WithTracerProvider(tp), WithServerIdentityAttributes())
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	defer parent.End()
+
+	require.NotPanics(t, func() {
+		ctx := tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+		tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+		ctx = tracer.TraceCopyFromStart(ctx, nil, pgx.TraceCopyFromStartData{TableName: pgx.Identifier{"t"}})
+		tracer.TraceCopyFromEnd(ctx, nil, pgx.TraceCopyFromEndData{})
+		ctx = tracer.TraceBatchStart(ctx, nil, pgx.TraceBatchStartData{})
+		tracer.TraceBatchQuery(ctx, nil, pgx.TraceBatchQueryData{SQL: "SELECT 1"})
+		tracer.TraceBatchEnd(ctx, nil, pgx.TraceBatchEndData{})
+		ctx = tracer.TracePrepareStart(ctx, nil, pgx.TracePrepareStartData{SQL: "SELECT 1"})
+		tracer.TracePrepareEnd(ctx, nil, pgx.TracePrepareEndData{})
+	})
+}
+
+func TestTracer_connMetricServerCached(t *testing.T) {
+	tracer := NewTracer()
+	conn := newMockConn(t, "fakehost", 5432, "fakeuser", "fakedb")
+
+	ctx := tracer.TraceQueryStart(context.Background(), conn, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	tracer.TraceQueryEnd(ctx, conn, pgx.TraceQueryEndData{})
+
+	server, ok := conn.PgConn().CustomData()[metricServerDataKey].(metricServer)
+	require.True(t, ok, "missing cached server details")
+	require.Equal(t, metricServer{namespace: "fakedb", address: "fakehost", port: 5432}, server)
+
+	// The connection config, which is copied on every access, is not read
+	// again once the server details are cached.
+	allocs := testing.AllocsPerRun(100, func() { connMetricServer(conn) })
+	require.Zero(t, allocs)
+}
+
+func TestTracer_InstrumentDialFunc(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	tracer := NewTracer(WithTracerProvider(tp), WithMeterProvider(mp))
+
+	conn := newMockConn(t, "fakehost", 5432, "fakeuser", "fakedb", func(config *pgx.ConnConfig) {
+		tracer.InstrumentDialFunc(&config.Config)
+		config.Tracer = tracer
+	})
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	ctx = tracer.TraceQueryStart(ctx, conn, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	// A Sync message, which the mock server ignores.
+	_, err := conn.PgConn().Conn().Write([]byte{'S', 0, 0, 0, 4})
+	require.NoError(t, err)
+	tracer.TraceQueryEnd(ctx, conn, pgx.TraceQueryEndData{})
+	parent.End()
+
+	spans := sr.Ended()
+	require.Len(t, spans, 2)
+	attrs := attribute.NewSet(spans[0].Attributes()...)
+	sent, ok := attrs.Value(NetworkBytesSentKey)
+	require.True(t, ok, "missing attribute %q", NetworkBytesSentKey)
+	require.Equal(t, int64(5), sent.AsInt64())
+	received, ok := attrs.Value(NetworkBytesReceivedKey)
+	require.True(t, ok, "missing attribute %q", NetworkBytesReceivedKey)
+	require.Equal(t, int64(0), received.AsInt64())
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	m, ok := findMetric(rm, string(DBClientNetworkIOKey))
+	require.True(t, ok, "missing %s metric", DBClientNetworkIOKey)
+	got := make(map[string]int64)
+	for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+		direction, _ := dp.Attributes.Value(semconv.NetworkIODirectionKey)
+		pool, _ := dp.Attributes.Value(semconv.DBClientConnectionPoolNameKey)
+		require.Equal(t, "fakehost:5432/fakedb", pool.AsString())
+		got[direction.AsString()] = dp.Value
+	}
+	// The startup exchange is included in the counts.
+	require.Greater(t, got["transmit"], int64(5))
+	require.Greater(t, got["receive"], int64(0))
+}
+
+func TestErrorType(t *testing.T) {
+	config, err := pgconn.ParseConfig("postgres://fakeuser@fakehost:5432/fakedb?sslmode=disable")
+	require.NoError(t, err)
+	config.LookupFunc = func(context.Context, string) ([]string, error) {
+		return []string{"10.0.0.1"}, nil
+	}
+	config.DialFunc = func(context.Context, string, string) (net.Conn, error) {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	}
+	_, dialErr := pgconn.ConnectConfig(context.Background(), config)
+	require.Error(t, dialErr)
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "PostgreSQL error", err: &pgconn.PgError{Code: "23505"}, want: "23505"},
+		{name: "deadline exceeded", err: fmt.Errorf("query: %w", context.DeadlineExceeded), want: "context.DeadlineExceeded"},
+		{name: "canceled", err: context.Canceled, want: "context.Canceled"},
+		{name: "transaction closed", err: pgx.ErrTxClosed, want: "pgx.ErrTxClosed"},
+		{name: "scan", err: pgx.ScanArgError{Err: errors.New("boom")}, want: "pgx.ScanArgError"},
+		{name: "network", err: &pgconn.ConnectError{Config: &pgconn.Config{}}, want: "pgconn.ConnectError"},
+		{name: "dial", err: fmt.Errorf("dial: %w", &net.OpError{Op: "dial", Err: errors.New("refused")}), want: "net.OpError"},
+		{name: "wrapped dial failure", err: fmt.Errorf("connect: %w", dialErr), want: "pgconn.ConnectError"},
+		{name: "unexpected EOF", err: io.ErrUnexpectedEOF, want: "io.EOF"},
+		{name: "other", err: errors.New("boom"), want: "_OTHER"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, errorType(tt.err))
+		})
+	}
+}
+
+func TestCancelReason(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "canceled", err: fmt.Errorf("query: %w", context.Canceled), want: "context_canceled"},
+		{name: "deadline exceeded", err: context.DeadlineExceeded, want: "context_deadline_exceeded"},
+		{
+			name: "statement timeout",
+			err:  &pgconn.PgError{Code: "57014", Message: "canceling statement due to statement timeout"},
+			want: "statement_timeout",
+		},
+		{
+			name: "user request",
+			err:  &pgconn.PgError{Code: "57014", Message: "canceling statement due to user request"},
+			want: "query_canceled",
+		},
+		{name: "server error", err: &pgconn.PgError{Code: "23505"}},
+		{name: "other", err: errors.New("boom")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, cancelReason(tt.err))
+		})
+	}
+}